@@ -0,0 +1,173 @@
+package fakeban
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 管理页面中 datetime-local 输入框的格式
+const adminTimeFormat = "2006-01-02T15:04"
+
+// 管理页面中的一个玩家
+type adminPlayer struct {
+	Key string
+	playerRecord
+	// 按配置得出的揭晓状态
+	reveal string
+}
+
+// 管理页面显示的揭晓状态
+func (p adminPlayer) RevealStatus() string {
+	switch p.reveal {
+	case RevealShow:
+		return "admin_state_ready"
+	case RevealDone:
+		return "admin_state_shown"
+	}
+	return "admin_state_banned"
+}
+
+// 通过Cookie认出的其他名称
+func (p adminPlayer) AliasList() string {
+	return strings.Join(p.Aliases, ", ")
+}
+
+// 玩家自己的揭晓时间，没有设置时为空
+func (p adminPlayer) RevealAtInput() string {
+	if p.RevealAt == nil {
+		return ""
+	}
+	return p.RevealAt.Format(adminTimeFormat)
+}
+
+// 所有玩家记录，最近登录的在前
+func (s *dataStore) playerList(reveal RevealConfig) []adminPlayer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	players := make([]adminPlayer, 0, len(s.Players))
+	for key, record := range s.Players {
+		players = append(players, adminPlayer{Key: key, playerRecord: record.copy(), reveal: revealState(reveal, *record)})
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].LastSeen.After(players[j].LastSeen)
+	})
+	return players
+}
+
+// 管理页面需要 web.admin_token，浏览器提示登录时用户名任意，密码为令牌
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.config.Web.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		_, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(s.config.Web.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fakeban", charset="UTF-8"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		// 浏览器会自动带上登录信息，拒绝其他网站提交的表单
+		if r.Method == http.MethodPost && r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+var adminPage = template.Must(template.New("admin").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Text.Get "admin_title"}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+input[type=number] { width: 5em; }
+form { display: inline; }
+</style>
+</head>
+<body>
+<h1>{{.Text.Get "admin_title"}}</h1>
+<p><a href="/admin/appeals">{{.Text.Get "admin_appeals"}}</a></p>
+<table>
+<tr>
+<th>{{.Text.Get "admin_player"}}</th>
+<th>{{.Text.Get "admin_ban_id"}}</th>
+<th>{{.Text.Get "admin_logins"}}</th>
+<th>{{.Text.Get "admin_last_seen"}}</th>
+<th>{{.Text.Get "admin_status"}}</th>
+<th>{{.Text.Get "admin_reveal"}}</th>
+</tr>
+{{range .Players}}
+<tr>
+<td>{{.Name}}{{with .AliasList}} ({{.}}){{end}}</td>
+<td>#{{.BanID}}</td>
+<td>{{.Logins}}</td>
+<td>{{.LastSeen.Format "2006-01-02 15:04"}}</td>
+<td>{{$.Text.Get .RevealStatus}}</td>
+<td>
+<form method="post" action="/admin/reveal">
+<input type="hidden" name="key" value="{{.Key}}">
+{{$.Text.Get "admin_reveal_attempts"}} <input type="number" min="0" name="attempts" value="{{.RevealAttempts}}">
+{{$.Text.Get "admin_reveal_at"}} <input type="datetime-local" name="at" value="{{.RevealAtInput}}">
+<button name="action" value="save">{{$.Text.Get "admin_save"}}</button>
+<button name="action" value="reveal">{{$.Text.Get "admin_reveal_now"}}</button>
+<button name="action" value="reset">{{$.Text.Get "admin_reset"}}</button>
+</form>
+</td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+// 管理页面，列出所有玩家和揭晓状态
+func (s *Server) handleAdminPage(w http.ResponseWriter, r *http.Request) {
+	locale := s.requestLocale(r)
+	page := struct {
+		Locale  string
+		Text    webText
+		Players []adminPlayer
+	}{Locale: locale, Text: webText{s, locale}, Players: s.store.playerList(s.config.Reveal)}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := adminPage.Execute(w, page); err != nil {
+		s.logf("log.web_error", err)
+	}
+}
+
+// 修改一个玩家的揭晓设置
+func (s *Server) handleAdminReveal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	attempts, _ := strconv.Atoi(r.PostFormValue("attempts"))
+	var at *time.Time
+	if value := r.PostFormValue("at"); value != "" {
+		parsed, err := time.ParseInLocation(adminTimeFormat, value, time.Local)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		at = &parsed
+	}
+
+	key, action := r.PostFormValue("key"), r.PostFormValue("action")
+	if !s.store.updateReveal(key, action, max(attempts, 0), at) {
+		http.NotFound(w, r)
+		return
+	}
+	s.logf("log.admin_reveal", key, action)
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
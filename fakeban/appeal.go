@@ -0,0 +1,414 @@
+package fakeban
+
+import (
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 申诉的状态，accepted 和 denied 也是 LoginRequest.Appeal 的值
+const (
+	AppealPending  = "pending"
+	AppealAccepted = "accepted"
+	AppealDenied   = "denied"
+)
+
+// 申诉编号的长度和字符，去掉了容易看错的 0、O、1、I
+const (
+	appealIDLength   = 8
+	appealIDAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// 申诉内容的最大长度
+	maxAppealText = 2000
+)
+
+var (
+	errAppealBanID   = newError("err.appeal_ban_id")
+	errAppealText    = newError("err.appeal_text", maxAppealText)
+	errAppealPending = newError("err.appeal_pending")
+)
+
+// 存储中的申诉，内容一直保留
+type appealRecord struct {
+	// 玩家记录的键和提交时的名称、封禁ID
+	PlayerKey string    `json:"player_key"`
+	Player    string    `json:"player"`
+	BanID     string    `json:"ban_id"`
+	Text      string    `json:"text"`
+	IP        string    `json:"ip"`
+	Created   time.Time `json:"created"`
+	Status    string    `json:"status"`
+	// 处理的时间和玩家登录时是否已经看到结果
+	Decided *time.Time `json:"decided,omitempty"`
+	Shown   bool       `json:"shown,omitempty"`
+}
+
+// 提交申诉，封禁ID必须属于这个玩家，返回申诉编号
+func (s *dataStore) addAppeal(player, banID, text, ip string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	banID = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(banID), "#"))
+	var key string
+	for k, record := range s.Players {
+		if record.BanID != "" && record.BanID == banID && record.hasName(player) {
+			key = k
+			break
+		}
+	}
+	if key == "" {
+		return "", errAppealBanID
+	}
+	text = strings.TrimSpace(text)
+	if text == "" || len([]rune(text)) > maxAppealText {
+		return "", errAppealText
+	}
+	for _, appeal := range s.Appeals {
+		if appeal.PlayerKey == key && appeal.Status == AppealPending {
+			return "", errAppealPending
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		id, err := randomString(appealIDAlphabet, appealIDLength)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := s.Appeals[id]; ok {
+			continue
+		}
+		s.Appeals[id] = &appealRecord{
+			PlayerKey: key,
+			Player:    s.Players[key].Name,
+			BanID:     banID,
+			Text:      text,
+			IP:        ip,
+			Created:   time.Now(),
+			Status:    AppealPending,
+		}
+		s.dirty = true
+		return id, nil
+	}
+	return "", newError("err.appeal_no_id")
+}
+
+// 按编号查找申诉
+func (s *dataStore) lookupAppeal(id string) (appealRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	appeal := s.Appeals[strings.ToUpper(strings.TrimSpace(id))]
+	if appeal == nil {
+		return appealRecord{}, false
+	}
+	return *appeal, true
+}
+
+// 玩家已经处理但还没有看到结果的申诉
+func (s *dataStore) decidedAppeal(key string) (string, appealRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, appeal := range s.Appeals {
+		if appeal.PlayerKey == key && appeal.Decided != nil && !appeal.Shown {
+			return id, *appeal, true
+		}
+	}
+	return "", appealRecord{}, false
+}
+
+// 记录玩家已经看到申诉的结果
+func (s *dataStore) markAppealShown(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if appeal := s.Appeals[id]; appeal != nil && !appeal.Shown {
+		appeal.Shown = true
+		s.dirty = true
+	}
+}
+
+// 管理页面处理申诉
+func (s *dataStore) decideAppeal(id, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	appeal := s.Appeals[id]
+	if appeal == nil {
+		return false
+	}
+	appeal.Status = status
+	appeal.Shown = false
+	if status == AppealPending {
+		appeal.Decided = nil
+	} else {
+		now := time.Now()
+		appeal.Decided = &now
+	}
+	s.dirty = true
+	return true
+}
+
+// 管理页面中的一个申诉
+type adminAppeal struct {
+	ID string
+	appealRecord
+}
+
+// 所有申诉，最新的在前
+func (s *dataStore) appealList() []adminAppeal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	appeals := make([]adminAppeal, 0, len(s.Appeals))
+	for id, appeal := range s.Appeals {
+		appeals = append(appeals, adminAppeal{ID: id, appealRecord: *appeal})
+	}
+	sort.Slice(appeals, func(i, j int) bool {
+		return appeals[i].Created.After(appeals[j].Created)
+	})
+	return appeals
+}
+
+// 申诉处理之后的第一次登录显示申诉的结果，没有结果时返回 false
+func appealLogin(req *LoginRequest) (LoginResult, bool) {
+	if req.Appeal != AppealAccepted && req.Appeal != AppealDenied {
+		return LoginResult{}, false
+	}
+	message := req.server.localizedMessage(req.Locale, "appeal_"+req.Appeal, messageData{
+		Player:      req.Player,
+		IP:          req.IP,
+		Protocol:    req.Handshake.ProtocolVersion,
+		Hostname:    cleanHostname(req.Handshake.ServerAddress),
+		GeoLocation: req.Geo,
+		BanID:       req.BanID,
+		AppealID:    req.AppealID,
+		Vars:        req.Host.Vars,
+	})
+	return Disconnect(message), true
+}
+
+var appealPage = template.Must(template.New("appeal").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Text.Get "appeal_title"}}</title>
+<style>
+body { font-family: "Segoe UI", sans-serif; background: #1c1c24; color: #ddd; margin: 0; }
+header { background: #101016; border-bottom: 3px solid #f5a623; padding: 1em 2em; }
+header span { color: #f5a623; font-size: 1.6em; font-weight: bold; letter-spacing: 0.05em; }
+main { max-width: 40em; margin: 2em auto; padding: 0 1em; }
+.box { background: #26262f; border: 1px solid #333; border-radius: 4px; padding: 1.5em; margin-bottom: 1.5em; }
+label { display: block; margin: 1em 0 0.3em; }
+input, textarea { width: 100%; padding: 0.5em; box-sizing: border-box; background: #14141a; color: #eee; border: 1px solid #444; }
+textarea { height: 10em; }
+button { margin-top: 1em; padding: 0.6em 2em; background: #f5a623; border: 0; color: #111; font-weight: bold; cursor: pointer; }
+code { font-size: 1.3em; color: #f5a623; }
+.error { color: #ff5555; }
+</style>
+</head>
+<body>
+<header><span>HYPIXEL</span></header>
+<main>
+<h1>{{.Text.Get "appeal_title"}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .ID}}
+<div class="box">
+<p>{{.Text.Get "appeal_submitted"}} <code>{{.ID}}</code></p>
+{{with .Appeal}}<p>{{$.Text.Get "appeal_status"}} {{$.Text.Get .StatusKey}}</p>{{end}}
+</div>
+{{end}}
+<div class="box">
+<p>{{.Text.Get "appeal_intro"}}</p>
+<form method="post">
+<label for="player">{{.Text.Get "appeal_player"}}</label>
+<input id="player" name="player" maxlength="16" required value="{{.Player}}">
+<label for="ban_id">{{.Text.Get "appeal_ban_id"}}</label>
+<input id="ban_id" name="ban_id" maxlength="9" required placeholder="#9BE61827" value="{{.BanID}}">
+<label for="text">{{.Text.Get "appeal_text"}}</label>
+<textarea id="text" name="text" maxlength="2000" required>{{.Body}}</textarea>
+<button type="submit">{{.Text.Get "appeal_submit"}}</button>
+</form>
+</div>
+<div class="box">
+<form method="get">
+<label for="track">{{.Text.Get "appeal_track"}}</label>
+<input id="track" name="track" maxlength="8" required>
+<button type="submit">{{.Text.Get "appeal_track_submit"}}</button>
+</form>
+</div>
+</main>
+</body>
+</html>
+`))
+
+// 申诉状态在网页上显示的文字
+func (a appealRecord) StatusKey() string {
+	return "appeal_status_" + a.Status
+}
+
+// 申诉页面，GET 显示表单或查询进度，POST 提交申诉
+func (s *Server) handleAppealPage(w http.ResponseWriter, r *http.Request) {
+	locale := s.requestLocale(r)
+	page := struct {
+		Locale string
+		Text   webText
+		Error  string
+		ID     string
+		Appeal *appealRecord
+		Player string
+		BanID  string
+		Body   string
+	}{Locale: locale, Text: webText{s, locale}}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	switch r.Method {
+	case http.MethodGet:
+		if track := r.URL.Query().Get("track"); track != "" {
+			appeal, ok := s.store.lookupAppeal(track)
+			if !ok {
+				page.Error = page.Text.Get("appeal_not_found")
+				w.WriteHeader(http.StatusNotFound)
+				break
+			}
+			page.ID = strings.ToUpper(strings.TrimSpace(track))
+			page.Appeal = &appeal
+		}
+	case http.MethodPost:
+		page.Player = r.PostFormValue("player")
+		page.BanID = r.PostFormValue("ban_id")
+		page.Body = r.PostFormValue("text")
+		if !s.forms.allow(remoteHTTPIP(r), s.config.Web.FormsPerHour) {
+			page.Error = page.Text.Get("form_rate_limited")
+			w.WriteHeader(http.StatusTooManyRequests)
+			break
+		}
+		id, err := s.store.addAppeal(page.Player, page.BanID, page.Body, remoteHTTPIP(r))
+		if err != nil {
+			page.Error = page.Text.Get(s.appealErrorKey(err))
+			w.WriteHeader(http.StatusBadRequest)
+			break
+		}
+		s.logf("log.appeal_created", id, page.Player, page.BanID)
+		page.ID = id
+		page.Player, page.BanID, page.Body = "", "", ""
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := appealPage.Execute(w, page); err != nil {
+		s.logf("log.web_error", err)
+	}
+}
+
+// 提交申诉失败时网页上显示的消息，其他错误只记录在日志中
+func (s *Server) appealErrorKey(err error) string {
+	switch {
+	case errors.Is(err, errAppealBanID):
+		return "appeal_bad_ban_id"
+	case errors.Is(err, errAppealText):
+		return "appeal_bad_text"
+	case errors.Is(err, errAppealPending):
+		return "appeal_already_pending"
+	}
+	s.logf("log.web_error", err)
+	return "appeal_failed"
+}
+
+// 网页请求的IP
+func remoteHTTPIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+var adminAppealsPage = template.Must(template.New("appeals").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Text.Get "admin_appeals"}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+td.text { max-width: 40em; white-space: pre-wrap; }
+form { display: inline; }
+</style>
+</head>
+<body>
+<h1>{{.Text.Get "admin_appeals"}}</h1>
+<p><a href="/admin">{{.Text.Get "admin_title"}}</a></p>
+<table>
+<tr>
+<th>{{.Text.Get "admin_appeal_id"}}</th>
+<th>{{.Text.Get "admin_player"}}</th>
+<th>{{.Text.Get "admin_ban_id"}}</th>
+<th>{{.Text.Get "admin_appeal_created"}}</th>
+<th>{{.Text.Get "admin_appeal_text"}}</th>
+<th>{{.Text.Get "admin_status"}}</th>
+</tr>
+{{range .Appeals}}
+<tr>
+<td>{{.ID}}</td>
+<td>{{.Player}}</td>
+<td>#{{.BanID}}</td>
+<td>{{.Created.Format "2006-01-02 15:04"}}</td>
+<td class="text">{{.Text}}</td>
+<td>
+{{$.Text.Get .StatusKey}}{{if .Shown}} ✓{{end}}
+<form method="post" action="/admin/appeal">
+<input type="hidden" name="id" value="{{.ID}}">
+<button name="action" value="accepted">{{$.Text.Get "admin_appeal_accept"}}</button>
+<button name="action" value="denied">{{$.Text.Get "admin_appeal_deny"}}</button>
+<button name="action" value="pending">{{$.Text.Get "admin_appeal_reset"}}</button>
+</form>
+</td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+// 管理页面，列出所有申诉
+func (s *Server) handleAdminAppeals(w http.ResponseWriter, r *http.Request) {
+	locale := s.requestLocale(r)
+	page := struct {
+		Locale  string
+		Text    webText
+		Appeals []adminAppeal
+	}{Locale: locale, Text: webText{s, locale}, Appeals: s.store.appealList()}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := adminAppealsPage.Execute(w, page); err != nil {
+		s.logf("log.web_error", err)
+	}
+}
+
+// 接受、拒绝或重新处理一个申诉
+func (s *Server) handleAdminAppeal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	id, action := r.PostFormValue("id"), r.PostFormValue("action")
+	switch action {
+	case AppealAccepted, AppealDenied, AppealPending:
+	default:
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	if !s.store.decideAppeal(id, action) {
+		http.NotFound(w, r)
+		return
+	}
+	s.logf("log.admin_appeal", id, action)
+	http.Redirect(w, r, "/admin/appeals", http.StatusSeeOther)
+}
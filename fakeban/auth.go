@@ -0,0 +1,376 @@
+package fakeban
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 登录阶段加密相关的数据包ID
+const (
+	encryptionRequestID  = 0x01 // 服务端 -> 客户端
+	encryptionResponseID = 0x01 // 客户端 -> 服务端
+)
+
+// 1.19和1.19.1可以用聊天签名代替验证令牌
+const (
+	protocol1_19   = 759
+	protocol1_19_2 = 760
+	protocol1_20_5 = 766
+)
+
+// 正版验证后得到的玩家档案
+type GameProfile struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Properties []ProfileProperty `json:"properties"`
+}
+
+type ProfileProperty struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// 带横线的UUID
+func (p *GameProfile) UUID() string {
+	if p == nil || len(p.ID) != 32 {
+		return ""
+	}
+	return p.ID[:8] + "-" + p.ID[8:12] + "-" + p.ID[12:16] + "-" + p.ID[16:20] + "-" + p.ID[20:]
+}
+
+// 从textures属性中解析出皮肤地址
+func (p *GameProfile) SkinURL() string {
+	if p == nil {
+		return ""
+	}
+	for _, property := range p.Properties {
+		if property.Name != "textures" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(property.Value)
+		if err != nil {
+			return ""
+		}
+		var textures struct {
+			Textures struct {
+				Skin struct {
+					URL string `json:"url"`
+				} `json:"SKIN"`
+			} `json:"textures"`
+		}
+		if err := json.Unmarshal(data, &textures); err != nil {
+			return ""
+		}
+		return textures.Textures.Skin.URL
+	}
+	return ""
+}
+
+// 服务器的RSA密钥，第一次使用时生成
+var serverKey struct {
+	once sync.Once
+	key  *rsa.PrivateKey
+	der  []byte
+	err  error
+}
+
+func loadServerKey() (*rsa.PrivateKey, []byte, error) {
+	serverKey.once.Do(func() {
+		serverKey.key, serverKey.err = rsa.GenerateKey(rand.Reader, 1024)
+		if serverKey.err != nil {
+			return
+		}
+		serverKey.der, serverKey.err = x509.MarshalPKIXPublicKey(&serverKey.key.PublicKey)
+	})
+	return serverKey.key, serverKey.der, serverKey.err
+}
+
+var sessionClient = &http.Client{Timeout: 5 * time.Second}
+
+// 正版验证第一步：发送加密请求，客户端的回复由 handleEncryptionResponse 处理
+func requestEncryption(c *connection) error {
+	_, der, err := loadServerKey()
+	if err != nil {
+		return err
+	}
+
+	c.verifyToken = make([]byte, 4)
+	if _, err := rand.Read(c.verifyToken); err != nil {
+		return err
+	}
+
+	request := new(bytes.Buffer)
+	writeString(request, "")
+	writeByteArray(request, der)
+	writeByteArray(request, c.verifyToken)
+	if c.protocol >= protocol1_20_5 {
+		// 客户端需要向会话服务器登记
+		request.WriteByte(1)
+	}
+	return c.writePacket(encryptionRequestID, request.Bytes())
+}
+
+// 正版验证第二步：解密共享密钥，开启加密并向会话服务器确认玩家身份
+func handleEncryptionResponse(c *connection, data []byte) error {
+	token := c.verifyToken
+	if token == nil {
+		return newError("err.auth_no_request")
+	}
+	// 每个加密请求只接受一次回复，否则第二次回复会在已经加密的连接上再套一层加密
+	c.verifyToken = nil
+
+	profile, err := authenticate(c, token, data)
+	if err != nil {
+		c.server.logf("log.auth_failed", c.obs.Player, err)
+		c.disconnect(c.message("unverified"))
+		return nil
+	}
+	c.server.logf("log.auth_succeeded", profile.Name, profile.UUID())
+	c.obs.Player = profile.Name
+	c.profile = profile
+	if handled, err := c.authenticatedRule(); handled {
+		return err
+	}
+	return loginVerified(c, profile)
+}
+
+// 验证之后按会话服务器返回的UUID重新选择规则，连接已经加密，不能再转发给 backend
+func (c *connection) authenticatedRule() (bool, error) {
+	switch c.selectRule().Action {
+	case ruleThrottle:
+		c.disconnect(c.message("throttle"))
+		return true, nil
+	case ruleOutdated:
+		c.disconnect(c.message("outdated"))
+		return true, nil
+	case ruleTransfer:
+		if c.protocol < protocol1_20_5 {
+			return false, nil
+		}
+		host, port, err := parseTransferTarget(c.server.config.TransferTarget)
+		if err != nil {
+			return true, err
+		}
+		return true, c.transferTo(&Transfer{Host: host, Port: port})
+	}
+	return false, nil
+}
+
+// 检查加密响应，token 是加密请求中发送的验证令牌，返回之后连接的读写都经过AES/CFB8加密
+func authenticate(c *connection, token, data []byte) (*GameProfile, error) {
+	key, der, err := loadServerKey()
+	if err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(data)
+	encryptedSecret, err := readByteArray(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hasVerifyToken := true
+	if c.protocol == protocol1_19 || c.protocol == protocol1_19_2 {
+		flag, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		hasVerifyToken = flag != 0
+	}
+	// 使用聊天签名的客户端没有验证令牌，身份由会话服务器确认
+	if hasVerifyToken {
+		encryptedToken, err := readByteArray(r)
+		if err != nil {
+			return nil, err
+		}
+		decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, key, encryptedToken)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(decrypted, token) {
+			return nil, newError("err.auth_verify_token")
+		}
+	}
+
+	secret, err := rsa.DecryptPKCS1v15(rand.Reader, key, encryptedSecret)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) != 16 {
+		return nil, newError("err.auth_secret_length", len(secret))
+	}
+
+	if err := c.enableEncryption(secret); err != nil {
+		return nil, err
+	}
+
+	return hasJoined(c.server.config.Auth, c.obs.Player, minecraftDigest("", secret, der), c.obs.IP)
+}
+
+// 向会话服务器确认玩家已经加入，URL可以在配置中替换成本地的模拟服务
+func hasJoined(cfg AuthConfig, player, serverHash, ip string) (*GameProfile, error) {
+	query := url.Values{}
+	query.Set("username", player)
+	query.Set("serverId", serverHash)
+	if cfg.PreventProxyConnections {
+		query.Set("ip", ip)
+	}
+
+	endpoint := strings.TrimSuffix(cfg.SessionServer, "/") + "/session/minecraft/hasJoined?" + query.Encode()
+	resp, err := sessionClient.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newError("err.auth_rejected", player, resp.Status)
+	}
+
+	var profile GameProfile
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(profile.Name, player) {
+		return nil, newError("err.auth_name_mismatch", profile.Name)
+	}
+	return &profile, nil
+}
+
+// Minecraft使用的SHA-1摘要：按有符号大整数输出十六进制
+func minecraftDigest(serverID string, secret, publicKey []byte) string {
+	h := sha1.New()
+	h.Write([]byte(serverID))
+	h.Write(secret)
+	h.Write(publicKey)
+	sum := h.Sum(nil)
+
+	negative := sum[0]&0x80 != 0
+	if negative {
+		// 取二进制补码
+		carry := true
+		for i := len(sum) - 1; i >= 0; i-- {
+			sum[i] = ^sum[i]
+			if carry {
+				sum[i]++
+				carry = sum[i] == 0
+			}
+		}
+	}
+
+	digest := strings.TrimLeft(hex.EncodeToString(sum), "0")
+	if digest == "" {
+		digest = "0"
+	}
+	if negative {
+		digest = "-" + digest
+	}
+	return digest
+}
+
+// 经过AES/CFB8加密的连接
+type encryptedConn struct {
+	net.Conn
+	decrypt cipher.Stream
+	encrypt cipher.Stream
+	mu      sync.Mutex
+}
+
+func newEncryptedConn(conn net.Conn, secret []byte) (*encryptedConn, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedConn{
+		Conn:    conn,
+		decrypt: newCFB8(block, secret, true),
+		encrypt: newCFB8(block, secret, false),
+	}, nil
+}
+
+func (c *encryptedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.decrypt.XORKeyStream(p[:n], p[:n])
+	return n, err
+}
+
+func (c *encryptedConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]byte, len(p))
+	c.encrypt.XORKeyStream(out, p)
+	return c.Conn.Write(out)
+}
+
+// 标准库没有CFB8，这里按字节实现
+type cfb8 struct {
+	block    cipher.Block
+	register []byte
+	out      []byte
+	decrypt  bool
+}
+
+func newCFB8(block cipher.Block, iv []byte, decrypt bool) cipher.Stream {
+	return &cfb8{
+		block:    block,
+		register: append([]byte(nil), iv...),
+		out:      make([]byte, block.BlockSize()),
+		decrypt:  decrypt,
+	}
+}
+
+func (c *cfb8) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		c.block.Encrypt(c.out, c.register)
+		in := src[i]
+		dst[i] = in ^ c.out[0]
+
+		// 寄存器左移一个字节，补上密文
+		copy(c.register, c.register[1:])
+		if c.decrypt {
+			c.register[len(c.register)-1] = in
+		} else {
+			c.register[len(c.register)-1] = dst[i]
+		}
+	}
+}
+
+func readByteArray(r io.Reader) ([]byte, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 || length > maxPacketLength {
+		return nil, newError("err.byte_array_length", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func writeByteArray(w io.Writer, data []byte) error {
+	if err := writeVarInt(w, len(data)); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
@@ -0,0 +1,416 @@
+package fakeban
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// NIST SP 800-38A F.3.7 CFB8-AES128
+func TestCFB8(t *testing.T) {
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	iv, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	plaintext, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d")
+	ciphertext, _ := hex.DecodeString("3b79424c9c0dd436bace9e0ed4586a4f32b9")
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]byte, len(plaintext))
+	newCFB8(block, iv, false).XORKeyStream(got, plaintext)
+	if !bytes.Equal(got, ciphertext) {
+		t.Errorf("加密结果 %x，应为 %x", got, ciphertext)
+	}
+
+	// 分成多次解密，结果和一次解密相同
+	got = make([]byte, len(ciphertext))
+	stream := newCFB8(block, iv, true)
+	stream.XORKeyStream(got[:5], ciphertext[:5])
+	stream.XORKeyStream(got[5:], ciphertext[5:])
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("解密结果 %x，应为 %x", got, plaintext)
+	}
+}
+
+// wiki.vg 上的示例摘要
+func TestMinecraftDigest(t *testing.T) {
+	tests := map[string]string{
+		"Notch": "4ed1f46bbe04bc756bcb17c0c7ce3e4632f06a48",
+		"jeb_":  "-7c9d5b0044c130109a5d7b5fb5c317c02b4e28c1",
+		"simon": "88e16a1019277b15d58faf0541e11910eb756f6",
+	}
+	for name, want := range tests {
+		if got := minecraftDigest(name, nil, nil); got != want {
+			t.Errorf("%s 的摘要为 %s，应为 %s", name, got, want)
+		}
+	}
+}
+
+const testProfileID = "069a79f444e94726a5befca90e38aaf5"
+
+// 模拟会话服务器的 hasJoined，记录收到的查询
+type sessionStub struct {
+	*httptest.Server
+	reject bool
+
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+func newSessionStub(t *testing.T, reject bool) *sessionStub {
+	stub := &sessionStub{reject: reject}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/session/minecraft/hasJoined" {
+			http.NotFound(w, r)
+			return
+		}
+		stub.mu.Lock()
+		stub.queries = append(stub.queries, r.URL.Query())
+		stub.mu.Unlock()
+
+		if stub.reject {
+			// 客户端没有向会话服务器登记时返回 204
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		json.NewEncoder(w).Encode(GameProfile{ID: testProfileID, Name: r.URL.Query().Get("username")})
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *sessionStub) lastQuery() url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queries) == 0 {
+		return nil
+	}
+	return s.queries[len(s.queries)-1]
+}
+
+// 启动测试用的服务器，登录结果显示验证得到的UUID
+func startAuthServer(t *testing.T, cfg Config) string {
+	t.Helper()
+	_, addr := startTestServer(t, cfg)
+	return addr
+}
+
+func startTestServer(t *testing.T, cfg Config) (*Server, string) {
+	t.Helper()
+	cfg.StoreFile = filepath.Join(t.TempDir(), "store.json")
+	cfg.Log = LogConfig{}
+	cfg.Scanner.Enabled = false
+	cfg.RateLimit.Enabled = false
+	cfg.CompressionThreshold = -1
+
+	server := &Server{
+		Config: &cfg,
+		Login: LoginHandlerFunc(func(req *LoginRequest) LoginResult {
+			return Disconnect(TextComponent{Text: "uuid=" + req.Profile.UUID()})
+		}),
+	}
+	if err := server.start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	return server, listener.Addr().String()
+}
+
+// 测试用的客户端，分帧和加密使用和服务器相同的实现
+func dialLogin(t *testing.T, addr string, protocol int, player string) *packetConn {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	handshake, err := encodeHandshake(Handshake{ProtocolVersion: protocol, ServerAddress: "localhost", Port: 25565, NextState: nextStateLogin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(handshake); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newPacketConn(conn)
+	loginStart := new(bytes.Buffer)
+	writeString(loginStart, player)
+	loginStart.Write(make([]byte, 16))
+	if err := client.writePacket(loginStartID, loginStart.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+type encryptionRequest struct {
+	publicKey   *rsa.PublicKey
+	der         []byte
+	verifyToken []byte
+}
+
+func readEncryptionRequest(t *testing.T, client *packetConn) encryptionRequest {
+	t.Helper()
+	id, data, err := client.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != encryptionRequestID {
+		t.Fatalf("收到数据包 0x%02X，应为加密请求", id)
+	}
+
+	r := bytes.NewReader(data)
+	if _, err := readString(r); err != nil {
+		t.Fatal(err)
+	}
+	der, err := readByteArray(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := readByteArray(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encryptionRequest{publicKey: key.(*rsa.PublicKey), der: der, verifyToken: token}
+}
+
+// 发送加密响应，1.19和1.19.1的客户端可以用聊天签名代替验证令牌
+func sendEncryptionResponse(t *testing.T, client *packetConn, protocol int, req encryptionRequest, secret, token []byte, signed bool) {
+	t.Helper()
+	encryptedSecret, err := rsa.EncryptPKCS1v15(rand.Reader, req.publicKey, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedToken, err := rsa.EncryptPKCS1v15(rand.Reader, req.publicKey, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := new(bytes.Buffer)
+	writeByteArray(data, encryptedSecret)
+	if protocol == protocol1_19 || protocol == protocol1_19_2 {
+		if signed {
+			data.WriteByte(0)
+			binary.Write(data, binary.BigEndian, int64(42))
+			writeByteArray(data, []byte("signature"))
+		} else {
+			data.WriteByte(1)
+			writeByteArray(data, encryptedToken)
+		}
+	} else {
+		writeByteArray(data, encryptedToken)
+	}
+	if err := client.writePacket(encryptionResponseID, data.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readLoginDisconnect(t *testing.T, client *packetConn) string {
+	t.Helper()
+	id, data, err := client.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != loginDisconnectID {
+		t.Fatalf("收到数据包 0x%02X，应为断开连接", id)
+	}
+	reason, err := readString(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reason
+}
+
+func onlineConfig(session string) Config {
+	cfg := DefaultConfig()
+	cfg.Auth.OnlineMode = true
+	cfg.Auth.SessionServer = session
+	return cfg
+}
+
+func TestOnlineLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol int
+		signed   bool
+	}{
+		{"1.21", protocol1_21, false},
+		{"1.20.5", protocol1_20_5, false},
+		{"1.19 验证令牌", protocol1_19, false},
+		{"1.19 聊天签名", protocol1_19, true},
+		{"1.19.2 验证令牌", protocol1_19_2, false},
+		{"1.19.2 聊天签名", protocol1_19_2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newSessionStub(t, false)
+			addr := startAuthServer(t, onlineConfig(session.URL))
+
+			client := dialLogin(t, addr, tt.protocol, "Notch")
+			req := readEncryptionRequest(t, client)
+			secret := make([]byte, 16)
+			rand.Read(secret)
+			sendEncryptionResponse(t, client, tt.protocol, req, secret, req.verifyToken, tt.signed)
+			if err := client.enableEncryption(secret); err != nil {
+				t.Fatal(err)
+			}
+
+			reason := readLoginDisconnect(t, client)
+			if !strings.Contains(reason, "uuid=069a79f4-44e9-4726-a5be-fca90e38aaf5") {
+				t.Errorf("登录结果 %s 中没有验证得到的UUID", reason)
+			}
+			query := session.lastQuery()
+			if query.Get("username") != "Notch" {
+				t.Errorf("会话服务器收到的玩家名称为 %q", query.Get("username"))
+			}
+			if want := minecraftDigest("", secret, req.der); query.Get("serverId") != want {
+				t.Errorf("会话服务器收到的 serverId 为 %q，应为 %q", query.Get("serverId"), want)
+			}
+		})
+	}
+}
+
+func TestOnlineLoginRejected(t *testing.T) {
+	t.Run("会话服务器拒绝", func(t *testing.T) {
+		session := newSessionStub(t, true)
+		addr := startAuthServer(t, onlineConfig(session.URL))
+
+		client := dialLogin(t, addr, protocol1_21, "Notch")
+		req := readEncryptionRequest(t, client)
+		secret := make([]byte, 16)
+		rand.Read(secret)
+		sendEncryptionResponse(t, client, protocol1_21, req, secret, req.verifyToken, false)
+		// 共享密钥已经交换，断开消息也是加密的
+		if err := client.enableEncryption(secret); err != nil {
+			t.Fatal(err)
+		}
+
+		reason := readLoginDisconnect(t, client)
+		if strings.Contains(reason, "uuid=") {
+			t.Errorf("没有通过验证的玩家收到了登录结果: %s", reason)
+		}
+		if session.lastQuery() == nil {
+			t.Error("没有查询会话服务器")
+		}
+	})
+
+	for _, protocol := range []int{protocol1_21, protocol1_19_2} {
+		t.Run("验证令牌不匹配 "+strconv.Itoa(protocol), func(t *testing.T) {
+			session := newSessionStub(t, false)
+			addr := startAuthServer(t, onlineConfig(session.URL))
+
+			client := dialLogin(t, addr, protocol, "Notch")
+			req := readEncryptionRequest(t, client)
+			secret := make([]byte, 16)
+			rand.Read(secret)
+			sendEncryptionResponse(t, client, protocol, req, secret, []byte("fake"), false)
+
+			// 检查令牌时还没有开启加密
+			reason := readLoginDisconnect(t, client)
+			if strings.Contains(reason, "uuid=") {
+				t.Errorf("验证令牌错误的玩家收到了登录结果: %s", reason)
+			}
+			if session.lastQuery() != nil {
+				t.Error("验证令牌错误时不应该查询会话服务器")
+			}
+		})
+	}
+}
+
+// 登录成功之后再发送一次加密响应，连接应该直接关闭，不能再开启一层加密
+func TestOnlineLoginSecondEncryptionResponse(t *testing.T) {
+	session := newSessionStub(t, false)
+	cfg := onlineConfig(session.URL)
+	cfg.Configuration.Enabled = true
+	addr := startAuthServer(t, cfg)
+
+	client := dialLogin(t, addr, protocol1_21, "Notch")
+	req := readEncryptionRequest(t, client)
+	secret := make([]byte, 16)
+	rand.Read(secret)
+	sendEncryptionResponse(t, client, protocol1_21, req, secret, req.verifyToken, false)
+	if err := client.enableEncryption(secret); err != nil {
+		t.Fatal(err)
+	}
+	id, _, err := client.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != loginSuccessID {
+		t.Fatalf("收到数据包 0x%02X，应为登录成功", id)
+	}
+
+	sendEncryptionResponse(t, client, protocol1_21, req, secret, req.verifyToken, false)
+	if id, _, err := client.readPacket(); err == nil {
+		t.Errorf("第二次加密响应之后收到了数据包 0x%02X，连接应该关闭", id)
+	}
+	session.mu.Lock()
+	n := len(session.queries)
+	session.mu.Unlock()
+	if n != 1 {
+		t.Errorf("会话服务器收到 %d 次查询，应为1次", n)
+	}
+}
+
+// 开启正版验证时UUID规则在验证之后匹配，第一次登录的玩家也能匹配
+func TestOnlineLoginUUIDRule(t *testing.T) {
+	session := newSessionStub(t, false)
+	cfg := onlineConfig(session.URL)
+	cfg.Rules = []Rule{{Name: "uuid", UUID: "069a79f4-44e9-4726-a5be-fca90e38aaf5", Action: ruleThrottle}}
+	addr := startAuthServer(t, cfg)
+
+	client := dialLogin(t, addr, protocol1_21, "Notch")
+	req := readEncryptionRequest(t, client)
+	secret := make([]byte, 16)
+	rand.Read(secret)
+	sendEncryptionResponse(t, client, protocol1_21, req, secret, req.verifyToken, false)
+	if err := client.enableEncryption(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	reason := readLoginDisconnect(t, client)
+	if strings.Contains(reason, "uuid=") {
+		t.Errorf("UUID规则没有匹配，玩家收到了登录结果: %s", reason)
+	}
+}
+
+func TestUUIDRulePassNeedsOfflineMode(t *testing.T) {
+	cfg := DefaultConfig()
+	rules := []Rule{{UUID: testProfileID, Action: rulePass}}
+	cfg.Auth.OnlineMode = false
+	if _, err := compileRules(rules, &cfg); err != nil {
+		t.Errorf("离线模式下应该允许: %v", err)
+	}
+	cfg.Auth.OnlineMode = true
+	if _, err := compileRules(rules, &cfg); err == nil {
+		t.Error("正版验证时带 uuid 的 pass 规则应该报错")
+	}
+}
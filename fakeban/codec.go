@@ -0,0 +1,161 @@
+package fakeban
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net"
+)
+
+// 登录阶段开启压缩的数据包ID
+const setCompressionID = 0x03
+
+// 解压后数据包的最大长度，和原版一致
+const maxUncompressedLength = 8388608
+
+// 数据包连接，记录这个连接的加密和压缩状态
+// 写入时先按压缩格式分帧再加密，读取时相反
+type packetConn struct {
+	net.Conn
+	// 压缩阈值，小于0表示没有开启压缩
+	threshold int
+}
+
+func newPacketConn(conn net.Conn) *packetConn {
+	return &packetConn{Conn: conn, threshold: -1}
+}
+
+// 开启AES/CFB8加密，之后所有读写都经过加密
+func (c *packetConn) enableEncryption(secret []byte) error {
+	encrypted, err := newEncryptedConn(c.Conn, secret)
+	if err != nil {
+		return err
+	}
+	c.Conn = encrypted
+	return nil
+}
+
+// 发送Set Compression并开启压缩，不小于阈值的数据包会被压缩
+func (c *packetConn) enableCompression(threshold int) error {
+	data := new(bytes.Buffer)
+	writeVarInt(data, threshold)
+	if err := c.writePacket(setCompressionID, data.Bytes()); err != nil {
+		return err
+	}
+	c.threshold = threshold
+	return nil
+}
+
+// 读取一个完整的数据包，返回包ID和剩余的数据
+func (c *packetConn) readPacket() (int, []byte, error) {
+	length, err := readVarInt(c)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length <= 0 || length > maxPacketLength {
+		return 0, nil, newError("err.packet_length", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c, data); err != nil {
+		return 0, nil, err
+	}
+
+	if c.threshold >= 0 {
+		data, err = decompressPacket(data, c.threshold)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	body := bytes.NewReader(data)
+	packetID, err := readVarInt(body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return packetID, data[len(data)-body.Len():], nil
+}
+
+// 写入一个完整的数据包
+func (c *packetConn) writePacket(packetID int, data []byte) error {
+	body := new(bytes.Buffer)
+	if err := writeVarInt(body, packetID); err != nil {
+		return err
+	}
+	body.Write(data)
+
+	packet, err := c.frame(body.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = c.Write(packet)
+	return err
+}
+
+// 给包ID加数据的内容加上长度前缀，开启压缩后使用压缩格式
+func (c *packetConn) frame(body []byte) ([]byte, error) {
+	if c.threshold >= 0 {
+		var err error
+		body, err = compressPacket(body, c.threshold)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	packet := new(bytes.Buffer)
+	if err := writeVarInt(packet, len(body)); err != nil {
+		return nil, err
+	}
+	packet.Write(body)
+	return packet.Bytes(), nil
+}
+
+// 压缩格式：解压后长度(VarInt，未压缩时为0) + 数据
+func compressPacket(body []byte, threshold int) ([]byte, error) {
+	out := new(bytes.Buffer)
+	if len(body) < threshold {
+		writeVarInt(out, 0)
+		out.Write(body)
+		return out.Bytes(), nil
+	}
+
+	writeVarInt(out, len(body))
+	w := zlib.NewWriter(out)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func decompressPacket(data []byte, threshold int) ([]byte, error) {
+	r := bytes.NewReader(data)
+	dataLength, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if dataLength == 0 {
+		return data[len(data)-r.Len():], nil
+	}
+	if dataLength < threshold || dataLength > maxUncompressedLength {
+		return nil, newError("err.compressed_length", dataLength)
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	body := make([]byte, dataLength)
+	if _, err := io.ReadFull(zr, body); err != nil {
+		return nil, newError("err.decompress", err)
+	}
+	// 和原版一样，解压出的内容比声明的长度多时拒绝，不继续解压
+	if n, _ := zr.Read(make([]byte, 1)); n > 0 {
+		return nil, newError("err.decompress_overflow", dataLength)
+	}
+	return body, nil
+}
@@ -0,0 +1,163 @@
+package fakeban
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+)
+
+// 只记录读写内容的连接
+type bufferConn struct {
+	net.Conn
+	bytes.Buffer
+}
+
+func (c *bufferConn) Read(p []byte) (int, error)  { return c.Buffer.Read(p) }
+func (c *bufferConn) Write(p []byte) (int, error) { return c.Buffer.Write(p) }
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// 原版服务器阈值为256时发送的 Set Compression
+func TestSetCompressionPacket(t *testing.T) {
+	conn := &bufferConn{}
+	c := newPacketConn(conn)
+	if err := c.enableCompression(256); err != nil {
+		t.Fatal(err)
+	}
+	if want := mustHex(t, "03 03 80 02"); !bytes.Equal(conn.Bytes(), want) {
+		t.Errorf("Set Compression 为 % x，应为 % x", conn.Bytes(), want)
+	}
+	if c.threshold != 256 {
+		t.Errorf("阈值为 %d，应为 256", c.threshold)
+	}
+}
+
+func TestCompressionThreshold(t *testing.T) {
+	const threshold = 256
+	tests := []struct {
+		name       string
+		size       int
+		compressed bool
+	}{
+		{"小于阈值", threshold - 1, false},
+		{"等于阈值", threshold, true},
+		{"大于阈值", 4096, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.Repeat([]byte{0x42}, tt.size)
+			data, err := compressPacket(body, threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dataLength, err := readVarInt(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.compressed && dataLength != tt.size {
+				t.Errorf("压缩后声明的长度为 %d，应为 %d", dataLength, tt.size)
+			}
+			if !tt.compressed && (dataLength != 0 || !bytes.Equal(data[1:], body)) {
+				t.Errorf("小于阈值的数据包应该原样发送，长度字段为 %d", dataLength)
+			}
+
+			got, err := decompressPacket(data, threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, body) {
+				t.Error("解压后的内容和原来不同")
+			}
+		})
+	}
+}
+
+// 原版客户端的压缩数据包：Java 的 Deflater 和 zlib 默认级别的输出相同
+func TestReadVanillaCompressedPacket(t *testing.T) {
+	frame := mustHex(t, "2a b4 02 789c63a8564a492d4e2eca2c28c9cccf53b2aa562a49ad2851b252721c055881526d2d00b2fc50b2")
+	// 未压缩的小数据包：Ping Request，长度 10，解压后长度 0
+	frame = append(frame, mustHex(t, "0a 00 01 00 00 00 00 00 00 00 2a")...)
+
+	c := newPacketConn(&bufferConn{Buffer: *bytes.NewBuffer(frame)})
+	c.threshold = 256
+
+	id, data, err := c.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"description":{"text":"` + strings.Repeat("A", 280) + `"}}`
+	if id != 0x00 || string(data) != want {
+		t.Errorf("压缩数据包解码为 0x%02X %q", id, data)
+	}
+
+	id, data, err = c.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != pingRequestID || !bytes.Equal(data, mustHex(t, "00 00 00 00 00 00 00 2a")) {
+		t.Errorf("未压缩数据包解码为 0x%02X % x", id, data)
+	}
+}
+
+func zlibBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := zlib.NewWriter(buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func compressedWithLength(t *testing.T, dataLength int, body []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	writeVarInt(buf, dataLength)
+	buf.Write(zlibBytes(t, body))
+	return buf.Bytes()
+}
+
+func TestDecompressRejects(t *testing.T) {
+	const threshold = 256
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		// 小于阈值的数据包不应该压缩
+		{"声明长度小于阈值", compressedWithLength(t, 10, bytes.Repeat([]byte{1}, 10))},
+		{"声明长度为负数", compressedWithLength(t, -1, bytes.Repeat([]byte{1}, 300))},
+		{"声明长度超过上限", compressedWithLength(t, maxUncompressedLength+1, []byte{1})},
+		{"解压后比声明的短", compressedWithLength(t, 1000, bytes.Repeat([]byte{1}, 300))},
+		// 64MB 的0压缩后只有几十KB，声明的长度很小
+		{"解压炸弹", compressedWithLength(t, 300, make([]byte, 64<<20))},
+		{"不是zlib数据", append(mustHex(t, "ac 02"), bytes.Repeat([]byte{0xff}, 32)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decompressPacket(tt.data, threshold); err == nil {
+				t.Error("应该返回错误")
+			}
+		})
+	}
+}
+
+func TestReadPacketRejectsLength(t *testing.T) {
+	for _, frame := range []string{"00", "ff ff ff ff 0f", "ff ff ff 7f"} {
+		c := newPacketConn(&bufferConn{Buffer: *bytes.NewBuffer(mustHex(t, frame))})
+		if _, _, err := c.readPacket(); err == nil {
+			t.Errorf("长度 % s 应该返回错误", frame)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package fakeban
+
+import (
+	"encoding/json"
+
+	"github.com/numakkiyu/FakeHypixelBan/nbt"
+)
+
+// 聊天组件，断开连接消息和MOTD使用
+// 1.20.3之前以JSON发送，之后配置和游戏阶段的数据包改为NBT
+//
+// Translate 不为空时是翻译组件，客户端按自己的语言文件显示，With 是填入的参数，
+// 客户端没有这个键时显示 Fallback，此时不会发送 Text
+type TextComponent struct {
+	Text          string          `json:"text,omitempty"`
+	Translate     string          `json:"translate,omitempty"`
+	With          []TextComponent `json:"with,omitempty"`
+	Fallback      string          `json:"fallback,omitempty"`
+	Color         string          `json:"color,omitempty"`
+	Bold          *bool           `json:"bold,omitempty"`
+	Italic        *bool           `json:"italic,omitempty"`
+	Underlined    *bool           `json:"underlined,omitempty"`
+	Strikethrough *bool           `json:"strikethrough,omitempty"`
+	Obfuscated    *bool           `json:"obfuscated,omitempty"`
+	Extra         []TextComponent `json:"extra,omitempty"`
+}
+
+// 断开连接消息就是一个聊天组件
+type DisconnectMessage = TextComponent
+
+// 实际发送的字段：同时有 text 和 translate 时客户端只显示 text，
+// 没有 translate 时即使 text 为空也必须发送
+type componentFields struct {
+	Text          *string         `json:"text,omitempty" nbt:"text"`
+	Translate     string          `json:"translate,omitempty" nbt:"translate,omitempty"`
+	With          []TextComponent `json:"with,omitempty" nbt:"with,omitempty"`
+	Fallback      string          `json:"fallback,omitempty" nbt:"fallback,omitempty"`
+	Color         string          `json:"color,omitempty" nbt:"color,omitempty"`
+	Bold          *bool           `json:"bold,omitempty" nbt:"bold"`
+	Italic        *bool           `json:"italic,omitempty" nbt:"italic"`
+	Underlined    *bool           `json:"underlined,omitempty" nbt:"underlined"`
+	Strikethrough *bool           `json:"strikethrough,omitempty" nbt:"strikethrough"`
+	Obfuscated    *bool           `json:"obfuscated,omitempty" nbt:"obfuscated"`
+	Extra         []TextComponent `json:"extra,omitempty" nbt:"extra,omitempty"`
+}
+
+func (c TextComponent) fields() componentFields {
+	fields := componentFields{
+		Translate:     c.Translate,
+		With:          c.With,
+		Fallback:      c.Fallback,
+		Color:         c.Color,
+		Bold:          c.Bold,
+		Italic:        c.Italic,
+		Underlined:    c.Underlined,
+		Strikethrough: c.Strikethrough,
+		Obfuscated:    c.Obfuscated,
+		Extra:         c.Extra,
+	}
+	if c.Translate == "" {
+		fields.Text = &c.Text
+	}
+	return fields
+}
+
+func (c TextComponent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.fields())
+}
+
+func (c TextComponent) MarshalNBT() (any, error) {
+	return c.fields(), nil
+}
+
+// 按网络格式编码为NBT，根标签不带名称
+func (c TextComponent) marshalNBT() ([]byte, error) {
+	return nbt.MarshalNetwork(c)
+}
@@ -0,0 +1,345 @@
+package fakeban
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// 服务器配置，未在配置文件中出现的字段使用默认值
+type Config struct {
+	Listen    string          `json:"listen"`
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	Scanner   ScannerConfig   `json:"scanner"`
+	Tarpit    TarpitConfig    `json:"tarpit"`
+	Log       LogConfig       `json:"log"`
+	Ban       BanConfig       `json:"ban"`
+	Forge     ForgeConfig     `json:"forge"`
+	Auth      AuthConfig      `json:"auth"`
+	// 1.20.2及以上的客户端先进入配置阶段再断开
+	Configuration ConfigurationConfig `json:"configuration"`
+	// 玩家看到的消息和控制台日志的语言
+	Locale LocaleConfig `json:"locale"`
+	// 按IP查询国家和城市
+	GeoIP GeoIPConfig `json:"geoip"`
+	// 按握手中的域名选择服务器列表内容和封禁消息，例如 hyp.example、*.example 和默认的 *
+	Hosts map[string]HostProfile `json:"hosts"`
+	// 恶作剧的揭晓
+	Reveal RevealConfig `json:"reveal"`
+	// 转移玩家时的目标服务器，例如 play.example.com:25565，需要1.20.5及以上的客户端
+	TransferTarget string `json:"transfer_target"`
+	// 恶作剧链接
+	Pranks PrankConfig `json:"pranks"`
+	// 网页，恶作剧链接的表单在 /prank
+	Web WebConfig `json:"web"`
+	// 短时间内反复连接时升级封禁
+	Escalation EscalationConfig `json:"escalation"`
+	// 用Cookie认出转移回来之后换了名称的玩家，需要1.20.5及以上的客户端和 configuration
+	Cookies CookieConfig `json:"cookies"`
+	// 封禁消息中的申诉地址，消息模板中的 {{.AppealURL}}
+	// 为空时开启了网页就使用网页上的申诉页面，否则使用Hypixel的申诉页面
+	AppealURL string `json:"appeal_url"`
+	// 1.21及以上的客户端在断开连接界面显示的链接，没有配置时使用申诉和规则两个链接
+	ServerLinks []ServerLink `json:"server_links"`
+	// 断开之前在配置阶段要求下载资源包，需要1.20.3及以上的客户端
+	ResourcePack ResourcePackConfig `json:"resource_pack"`
+	// 决定每个连接结果的规则，按顺序匹配第一个
+	Rules []Rule `json:"rules"`
+	// pass 动作转发到的真正服务器，例如 127.0.0.1:25566
+	Backend string `json:"backend"`
+	// 低于这个协议版本的客户端收到版本过旧的消息
+	MinProtocol int `json:"min_protocol"`
+	// 玩家记录等持久化数据
+	StoreFile string `json:"store_file"`
+	// 登录阶段开启压缩的阈值，小于0表示不压缩
+	CompressionThreshold int `json:"compression_threshold"`
+	// 客户端识别特征，按顺序匹配第一个
+	ClientSignatures []ClientSignature `json:"client_signatures"`
+}
+
+// 连接限流配置，速率单位为每秒新连接数，0表示不限制
+type RateLimitConfig struct {
+	Enabled        bool    `json:"enabled"`
+	PerIPMaxConns  int     `json:"per_ip_max_conns"`
+	PerIPRate      float64 `json:"per_ip_rate"`
+	PerIPBurst     int     `json:"per_ip_burst"`
+	GlobalMaxConns int     `json:"global_max_conns"`
+	GlobalRate     float64 `json:"global_rate"`
+	GlobalBurst    int     `json:"global_burst"`
+	// 同时处理的被限流连接上限，超过后直接关闭
+	ThrottledMax int `json:"throttled_max"`
+	// 10分钟内被限流这么多次的IP会被标记为滥用
+	AbuseStrikes int `json:"abuse_strikes"`
+}
+
+// 扫描器识别配置
+type ScannerConfig struct {
+	Enabled bool   `json:"enabled"`
+	LogFile string `json:"log_file"`
+	// 扫描器常用的协议版本号
+	Protocols []int `json:"protocols"`
+	// 扫描器常用的握手主机名，正则表达式
+	HostnamePatterns []string `json:"hostname_patterns"`
+}
+
+// 焦油坑配置，只对被扫描器识别或限流器标记的IP生效
+type TarpitConfig struct {
+	Enabled bool `json:"enabled"`
+	// 启用的模式: drip、stall、absurd
+	Modes []string `json:"modes"`
+	// 同时在焦油坑中的连接上限，每个连接占用一个goroutine
+	MaxConns int `json:"max_conns"`
+	// 所有焦油坑连接待发送数据的总字节数上限
+	MaxBytes int `json:"max_bytes"`
+	// 单个连接在焦油坑中的最长时间
+	MaxSeconds int `json:"max_seconds"`
+	// 扫描器日志中的IP最后出现之后多少小时内会进入焦油坑，0表示一直有效
+	FlagHours int `json:"flag_hours"`
+	// drip模式下每个字节的间隔
+	DripIntervalMillis int    `json:"drip_interval_millis"`
+	AbsurdOnline       int    `json:"absurd_online"`
+	AbsurdMax          int    `json:"absurd_max"`
+	AbsurdMOTD         string `json:"absurd_motd"`
+}
+
+// 连接日志和统计文件，为空时不写入
+type LogConfig struct {
+	ConnectionsFile string `json:"connections_file"`
+	StatsFile       string `json:"stats_file"`
+}
+
+// 封禁消息，每行是一个text/template模板，各行直接拼接
+// 不为空时替换所有语言的封禁消息，为空时使用消息目录
+type BanConfig struct {
+	Lines []string `json:"lines"`
+	// text 按消息目录中的 ban 生成文字，translate 使用原版的翻译键，客户端按自己的语言显示
+	Mode string `json:"mode"`
+	// translate 模式下显示的封禁时长，0表示永久封禁
+	ExpiresSeconds int `json:"expires_seconds"`
+	// translate 模式下显示为IP封禁
+	IP bool `json:"ip"`
+}
+
+// Forge模组列表识别配置
+type ForgeConfig struct {
+	// 登录时和Forge客户端交换模组列表
+	DetectMods bool `json:"detect_mods"`
+	// 视为作弊的模组ID，不区分大小写
+	CheatMods []string `json:"cheat_mods"`
+}
+
+// 正版验证配置
+type AuthConfig struct {
+	OnlineMode bool `json:"online_mode"`
+	// 会话服务器地址，测试时可以换成本地的模拟服务
+	SessionServer string `json:"session_server"`
+	// 向会话服务器同时提交玩家IP
+	PreventProxyConnections bool `json:"prevent_proxy_connections"`
+}
+
+// 配置阶段设置
+type ConfigurationConfig struct {
+	// 发送登录成功，在配置阶段读取客户端品牌和语言后再断开
+	Enabled bool `json:"enabled"`
+}
+
+// 语言配置，语言代码不区分大小写，例如 en_us、zh_cn、de_de
+type LocaleConfig struct {
+	// 客户端没有发送语言、玩家和主机名也没有设置时使用
+	Default string `json:"default"`
+	// 控制台日志的语言
+	Console string `json:"console"`
+	// 握手主机名对应的语言
+	Hostnames map[string]string `json:"hostnames"`
+	// 国家ISO代码对应的语言，例如 DE，需要配置IP数据库
+	Countries map[string]string `json:"countries"`
+	// 按语言覆盖或添加消息，键和内置的消息目录相同
+	Messages map[string]map[string]Message `json:"messages"`
+}
+
+// IP数据库配置
+type GeoIPConfig struct {
+	// MaxMind格式的数据库文件，例如 GeoLite2-City.mmdb，为空时不查询
+	Database string `json:"database"`
+	// 检查数据库文件是否修改的间隔
+	ReloadSeconds int `json:"reload_seconds"`
+}
+
+// 升级封禁配置，登录次数按玩家记录在存储中
+type EscalationConfig struct {
+	Enabled bool `json:"enabled"`
+	// 超过这个时间没有再连接时，级别和次数清零
+	QuietSeconds int `json:"quiet_seconds"`
+	// 按顺序排列的级别，满足条件时升到这一级并生成新的封禁ID，没有配置时10分钟内登录3次升一级
+	Steps []EscalationStep `json:"steps"`
+}
+
+// 升级封禁的一个级别
+type EscalationStep struct {
+	// within_seconds 秒内登录了 attempts 次，within_seconds 为0时统计清零以来的所有登录
+	Attempts      int `json:"attempts"`
+	WithinSeconds int `json:"within_seconds"`
+	// 消息目录中的键，text 模式使用 message，translate 模式使用 reason 作为封禁原因
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	// translate 模式下显示的封禁时长，0表示永久封禁
+	ExpiresSeconds int `json:"expires_seconds"`
+}
+
+// Cookie配置，登录时读取Cookie，进入配置阶段后保存
+type CookieConfig struct {
+	Enabled bool `json:"enabled"`
+	// 签名Cookie的密钥，为空时生成一个随机密钥保存在存储中
+	Secret string `json:"secret"`
+}
+
+// 资源包配置，玩家接受、拒绝或下载失败后再发送封禁消息
+type ResourcePackConfig struct {
+	Enabled bool `json:"enabled"`
+	// zip文件路径，为空时使用一个空的资源包
+	File string `json:"file"`
+	// 客户端下载的地址，为空时使用握手中的域名和 web.listen 的端口
+	URL string `json:"url"`
+	// 为 true 时玩家不能跳过，原版客户端拒绝后会自己断开
+	Required bool `json:"required"`
+	// 消息目录中的键，prompt 是下载提示，message 是之后的封禁消息
+	Prompt  string `json:"prompt"`
+	Message string `json:"message"`
+	// 等待客户端下载和加载的时间
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// 揭晓配置，满足条件后玩家下一次登录看到揭晓界面而不是封禁消息
+// 每个玩家的条件可以在管理页面修改，没有修改时使用这里的设置
+type RevealConfig struct {
+	Enabled bool `json:"enabled"`
+	// 登录了 attempts 次之后，或第一次登录后经过 after_seconds 秒，0表示不使用这个条件
+	Attempts     int `json:"attempts"`
+	AfterSeconds int `json:"after_seconds"`
+	// 揭晓界面在消息目录中的键
+	Message string `json:"message"`
+	// 不为空时，已经揭晓的玩家的IP在服务器列表中看到这个MOTD
+	MOTD string `json:"motd"`
+	// 显示揭晓界面之后再登录：为空时继续显示揭晓界面，pass 转发给 backend，transfer 转移到 transfer_target
+	Then string `json:"then"`
+}
+
+// 恶作剧链接配置，每个链接是 domain 下的一个子域名
+type PrankConfig struct {
+	// 指向这台服务器的通配符域名的上一级，例如 fake.example，为空时不能创建链接
+	Domain string `json:"domain"`
+	// 链接的有效期
+	ExpiresSeconds int `json:"expires_seconds"`
+	// 同一个所有者令牌同时有效的链接数量上限，0表示不限制
+	MaxPerOwner int `json:"max_per_owner"`
+	// 消息目录中的键，MOTD为空时使用域名配置中的MOTD
+	MOTD    string `json:"motd"`
+	Message string `json:"message"`
+}
+
+// 网页配置
+type WebConfig struct {
+	// 监听地址，例如 :8080，为空时不启动网页
+	Listen string `json:"listen"`
+	// 管理页面 /admin 的令牌，浏览器提示登录时作为密码输入，为空时不开启管理页面
+	AdminToken string `json:"admin_token"`
+	// 每个IP每小时最多提交的表单数量，0 表示不限制
+	FormsPerHour int `json:"forms_per_hour"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Listen: ":25565",
+		RateLimit: RateLimitConfig{
+			Enabled:        true,
+			PerIPMaxConns:  4,
+			PerIPRate:      1,
+			PerIPBurst:     5,
+			GlobalMaxConns: 512,
+			GlobalRate:     100,
+			GlobalBurst:    200,
+			ThrottledMax:   64,
+			AbuseStrikes:   20,
+		},
+		Scanner: ScannerConfig{
+			Enabled:          true,
+			LogFile:          "scanners.json",
+			Protocols:        []int{-1, 0},
+			HostnamePatterns: []string{`^$`, `^0\.0\.0\.0$`},
+		},
+		Tarpit: TarpitConfig{
+			Enabled:            false,
+			Modes:              []string{tarpitDrip, tarpitStall, tarpitAbsurd},
+			MaxConns:           32,
+			MaxBytes:           1 << 20,
+			MaxSeconds:         300,
+			FlagHours:          24,
+			DripIntervalMillis: 1000,
+			AbsurdOnline:       2147483647,
+			AbsurdMax:          -1,
+			AbsurdMOTD:         "§k||||||||||||||||||||§r §4§lWATCHDOG IS WATCHING YOU §r§k||||||||||||||||||||",
+		},
+		Log: LogConfig{
+			ConnectionsFile: "connections.jsonl",
+			StatsFile:       "stats.json",
+		},
+		Locale: LocaleConfig{
+			Default: "en_us",
+			Console: defaultConsoleLocale,
+		},
+		GeoIP: GeoIPConfig{
+			ReloadSeconds: 10,
+		},
+		Escalation: EscalationConfig{
+			QuietSeconds: 1800,
+		},
+		Reveal: RevealConfig{
+			Message: "reveal",
+		},
+		ResourcePack: ResourcePackConfig{
+			Prompt:         "pack_prompt",
+			Message:        "ban_scan",
+			TimeoutSeconds: 30,
+		},
+		Web: WebConfig{
+			FormsPerHour: 10,
+		},
+		Pranks: PrankConfig{
+			ExpiresSeconds: 7 * 24 * 3600,
+			MaxPerOwner:    5,
+			Message:        "prank_ban",
+		},
+		MinProtocol: 47,
+		Ban: BanConfig{
+			Mode:           banModeText,
+			ExpiresSeconds: 29*24*3600 + 23*3600 + 59*60 + 59,
+		},
+		Auth: AuthConfig{
+			OnlineMode:    false,
+			SessionServer: "https://sessionserver.mojang.com",
+		},
+		StoreFile:            "store.json",
+		CompressionThreshold: 256,
+		Forge: ForgeConfig{
+			DetectMods: true,
+			CheatMods:  []string{"xaerominimap", "xaeroworldmap", "journeymap", "freecam", "wurst", "meteor-client", "baritone", "inventoryprofilesnext"},
+		},
+	}
+}
+
+// 读取JSON配置文件，文件不存在时使用默认配置
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
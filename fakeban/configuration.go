@@ -0,0 +1,237 @@
+package fakeban
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// 1.20.2开始登录之后进入配置阶段，1.20.3开始聊天组件改用NBT
+const (
+	protocol1_20_2 = 764
+	protocol1_20_3 = 765
+	protocol1_21_2 = 768
+)
+
+// 登录阶段的数据包ID
+const (
+	loginSuccessID      = 0x02 // 服务端 -> 客户端
+	loginAcknowledgedID = 0x03 // 客户端 -> 服务端
+)
+
+// 配置阶段的数据包ID，1.20.5插入了Cookie相关的数据包，之后的ID都变了
+const clientInformationID = 0x00 // 客户端 -> 服务端，所有版本相同
+
+func configPluginMessageID(protocol int) int { // 客户端 -> 服务端
+	if protocol >= protocol1_20_5 {
+		return 0x02
+	}
+	return 0x01
+}
+
+func configDisconnectID(protocol int) int { // 服务端 -> 客户端
+	if protocol >= protocol1_20_5 {
+		return 0x02
+	}
+	return 0x01
+}
+
+// 客户端进入配置阶段后会马上发送品牌和客户端信息
+const clientInformationTimeout = 5 * time.Second
+
+// 客户端品牌的插件频道
+const brandChannel = "minecraft:brand"
+
+// ClientInformation 客户端在配置阶段发送的设置
+type ClientInformation struct {
+	Locale       string `json:"locale"`
+	ViewDistance int    `json:"view_distance"`
+	ChatMode     int    `json:"chat_mode"`
+	ChatColors   bool   `json:"chat_colors"`
+	// 显示的皮肤部分，每一位对应披风、外套、左右袖子、左右裤腿和帽子
+	SkinParts           byte `json:"skin_parts"`
+	MainHand            int  `json:"main_hand"`
+	TextFiltering       bool `json:"text_filtering"`
+	AllowServerListings bool `json:"allow_server_listings"`
+}
+
+// 登录完成：支持配置阶段的客户端先进入配置阶段，其他客户端直接决定结果
+func completeLogin(c *connection) error {
+	if !c.server.config.Configuration.Enabled || c.protocol < protocol1_20_2 {
+		return finishLogin(c)
+	}
+	if err := sendLoginSuccess(c); err != nil {
+		return newError("err.send_login_success", err)
+	}
+	c.await(clientInformationTimeout, finishLogin)
+	return nil
+}
+
+// 发送Login Success，客户端回复Login Acknowledged后进入配置阶段
+func sendLoginSuccess(c *connection) error {
+	data := new(bytes.Buffer)
+
+	uuid := offlineUUID(c.obs.Player)
+	var properties []ProfileProperty
+	if c.profile != nil {
+		id, err := hex.DecodeString(c.profile.ID)
+		if err == nil && len(id) == 16 {
+			copy(uuid[:], id)
+		}
+		properties = c.profile.Properties
+	}
+	data.Write(uuid[:])
+	writeString(data, c.obs.Player)
+
+	writeVarInt(data, len(properties))
+	for _, property := range properties {
+		writeString(data, property.Name)
+		writeString(data, property.Value)
+		if property.Signature != "" {
+			data.WriteByte(1)
+			writeString(data, property.Signature)
+		} else {
+			data.WriteByte(0)
+		}
+	}
+
+	// 1.20.5到1.21.1多了一个是否严格处理错误的字段
+	if c.protocol >= protocol1_20_5 && c.protocol < protocol1_21_2 {
+		data.WriteByte(0)
+	}
+	return c.writePacket(loginSuccessID, data.Bytes())
+}
+
+// 离线玩家的UUID，和原版一样由 "OfflinePlayer:" 加名称生成
+func offlineUUID(name string) [16]byte {
+	uuid := md5.Sum([]byte("OfflinePlayer:" + name))
+	uuid[6] = uuid[6]&0x0f | 0x30
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return uuid
+}
+
+func handleLoginAcknowledged(c *connection, data []byte) error {
+	c.state = stateConfiguration
+	c.obs.mark("configuration")
+	if c.cookiesEnabled() && c.recordKey != "" {
+		if err := sendStoreCookie(c); err != nil {
+			return newError("err.store_cookie", err)
+		}
+	}
+	if c.transfer != nil {
+		return sendTransfer(c, c.transfer)
+	}
+	return nil
+}
+
+func handleClientInformation(c *connection, data []byte) error {
+	info, err := readClientInformation(bytes.NewReader(data))
+	if err != nil {
+		return newError("err.read_client_info", err)
+	}
+	c.info = info
+	if info.Locale != "" {
+		c.server.store.setLocale(c.obs.Player, c.profile, info.Locale)
+	}
+	c.server.logf("log.client_information",
+		c.obs.Player, info.Locale, info.ViewDistance, info.SkinParts)
+	return c.configurationReceived()
+}
+
+// 1.21.2在末尾加了粒子设置，这里不需要
+func readClientInformation(r *bytes.Reader) (*ClientInformation, error) {
+	info := &ClientInformation{}
+
+	var err error
+	if info.Locale, err = readString(r); err != nil {
+		return nil, err
+	}
+	viewDistance, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	info.ViewDistance = int(int8(viewDistance))
+	if info.ChatMode, err = readVarInt(r); err != nil {
+		return nil, err
+	}
+
+	var flags [2]byte
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return nil, err
+	}
+	info.ChatColors = flags[0] != 0
+	info.SkinParts = flags[1]
+
+	if info.MainHand, err = readVarInt(r); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return nil, err
+	}
+	info.TextFiltering = flags[0] != 0
+	info.AllowServerListings = flags[1] != 0
+	return info, nil
+}
+
+func handleConfigPluginMessage(c *connection, data []byte) error {
+	r := bytes.NewReader(data)
+	channel, err := readString(r)
+	if err != nil {
+		return newError("err.read_plugin_channel", err)
+	}
+	if channel != brandChannel {
+		return nil
+	}
+
+	brand, err := readString(r)
+	if err != nil {
+		return newError("err.read_brand", err)
+	}
+	c.brand = brand
+	c.obs.Brand = brand
+	c.server.logf("log.client_brand", c.obs.Player, brand)
+	return c.configurationReceived()
+}
+
+// 品牌和客户端信息都收到后决定登录结果
+func (c *connection) configurationReceived() error {
+	if c.brand == "" || c.info == nil || c.closed {
+		return nil
+	}
+	c.stopWaiting()
+	if c.resourcePackEnabled() && !c.packSent {
+		return sendResourcePack(c)
+	}
+	return finishLogin(c)
+}
+
+// 配置阶段的断开连接消息，1.20.3开始使用NBT
+func sendConfigDisconnect(c *connection, message DisconnectMessage) {
+	message = message.forProtocol(c.protocol)
+	data := new(bytes.Buffer)
+	if c.protocol >= protocol1_20_3 {
+		encoded, err := message.marshalNBT()
+		if err != nil {
+			c.server.logf("log.disconnect_encode_error", err)
+			return
+		}
+		data.Write(encoded)
+	} else {
+		encoded, err := json.Marshal(message)
+		if err != nil {
+			c.server.logf("log.disconnect_encode_error", err)
+			return
+		}
+		writeString(data, string(encoded))
+	}
+
+	if err := c.sendPacket(packetDisconnect, configDisconnectID(c.protocol), data.Bytes()); err != nil {
+		c.server.logf("log.disconnect_send_error", err)
+		return
+	}
+
+	c.server.logf("log.disconnect_sent")
+}
@@ -0,0 +1,157 @@
+package fakeban
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// 1.20.5开始的Cookie数据包
+const (
+	loginCookieRequestID  = 0x05 // 服务端 -> 客户端，登录阶段
+	loginCookieResponseID = 0x04 // 客户端 -> 服务端，登录阶段
+	configStoreCookieID   = 0x0A // 服务端 -> 客户端，配置阶段
+)
+
+// 保存玩家记录键的Cookie
+const cookieKey = "hypixel:session"
+
+// 客户端收到Cookie请求后马上回复，没有这个Cookie时也会回复空的内容
+const cookieTimeout = 5 * time.Second
+
+// Cookie内容的最大长度，和客户端的限制相同
+const maxCookieLength = 5120
+
+// Cookie只能在配置阶段保存，没有开启配置阶段时开启Cookie没有意义
+func checkCookies(cfg *Config) error {
+	if cfg.Cookies.Enabled && !cfg.Configuration.Enabled {
+		return newError("err.cookies_need_configuration")
+	}
+	return nil
+}
+
+// 签名Cookie使用的密钥，优先使用配置中的密钥，否则使用存储中的密钥
+func (s *Server) loadCookieSecret(cfg *Config) error {
+	if cfg.Cookies.Secret != "" {
+		s.cookieSecret = []byte(cfg.Cookies.Secret)
+		return nil
+	}
+	secret, err := s.store.cookieSecret()
+	if err != nil {
+		return err
+	}
+	s.cookieSecret = []byte(secret)
+	return nil
+}
+
+// 存储中的密钥，第一次使用时生成
+func (s *dataStore) cookieSecret() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.CookieSecret == "" {
+		secret, err := randomString("0123456789abcdef", 64)
+		if err != nil {
+			return "", err
+		}
+		s.CookieSecret = secret
+		s.dirty = true
+	}
+	return s.CookieSecret, nil
+}
+
+// Cookie的内容为 记录键.签名
+func (s *Server) signCookie(key string) []byte {
+	mac := hmac.New(sha256.New, s.cookieSecret)
+	mac.Write([]byte(key))
+	return []byte(key + "." + hex.EncodeToString(mac.Sum(nil)))
+}
+
+// 检查签名，返回Cookie中的记录键
+func (s *Server) verifyCookie(payload []byte) (string, bool) {
+	i := bytes.LastIndexByte(payload, '.')
+	if i <= 0 {
+		return "", false
+	}
+	key := string(payload[:i])
+	return key, hmac.Equal(s.signCookie(key), payload)
+}
+
+// 玩家身份确认后先读取Cookie，客户端的回复由 handleCookieResponse 处理
+func requestCookie(c *connection) error {
+	data := new(bytes.Buffer)
+	writeString(data, cookieKey)
+	if err := c.writePacket(loginCookieRequestID, data.Bytes()); err != nil {
+		return newError("err.send_cookie_request", err)
+	}
+	c.await(cookieTimeout, loginIdentified)
+	return nil
+}
+
+func handleCookieResponse(c *connection, data []byte) error {
+	r := bytes.NewReader(data)
+	key, err := readString(r)
+	if err != nil {
+		return newError("err.read_cookie", err)
+	}
+	hasPayload, err := r.ReadByte()
+	if err != nil {
+		return newError("err.read_cookie", err)
+	}
+	if key == cookieKey && hasPayload != 0 {
+		length, err := readVarInt(r)
+		if err != nil || length < 0 || length > maxCookieLength || length > r.Len() {
+			return newError("err.cookie_length", length)
+		}
+		payload := make([]byte, length)
+		r.Read(payload)
+		if linked, ok := c.server.verifyCookie(payload); ok {
+			c.cookieLink = linked
+		} else {
+			c.server.logf("log.cookie_invalid", c.obs.Player, c.obs.IP)
+		}
+	}
+	c.stopWaiting()
+	return loginIdentified(c)
+}
+
+// 进入配置阶段后保存玩家记录键的Cookie
+func sendStoreCookie(c *connection) error {
+	payload := c.server.signCookie(c.recordKey)
+	data := new(bytes.Buffer)
+	writeString(data, cookieKey)
+	writeVarInt(data, len(payload))
+	data.Write(payload)
+	return c.writePacket(configStoreCookieID, data.Bytes())
+}
+
+// 是否需要读取和保存Cookie
+func (c *connection) cookiesEnabled() bool {
+	return c.server.config.Cookies.Enabled && c.protocol >= protocol1_20_5
+}
+
+// 把新的记录键关联到原来的记录，调用方持有存储的锁
+func (s *dataStore) link(key, original, name string) {
+	record := s.Players[original]
+	s.Links[key] = original
+	if !record.hasName(name) {
+		record.Aliases = append(record.Aliases, name)
+	}
+	s.logf("log.cookie_linked", name, record.Name, record.BanID)
+}
+
+// 名称或通过Cookie认出的其他名称是否为 name，不区分大小写
+func (r *playerRecord) hasName(name string) bool {
+	if strings.EqualFold(r.Name, name) {
+		return true
+	}
+	for _, alias := range r.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package fakeban
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func cookieConfig(t *testing.T) Config {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.StoreFile = filepath.Join(t.TempDir(), "store.json")
+	cfg.Log = LogConfig{}
+	cfg.Scanner.Enabled = false
+	cfg.Configuration.Enabled = true
+	cfg.Cookies.Enabled = true
+	return cfg
+}
+
+func TestSignCookie(t *testing.T) {
+	s := &Server{cookieSecret: []byte("secret")}
+	other := &Server{cookieSecret: []byte("other")}
+
+	payload := s.signCookie("steve")
+	if key, ok := s.verifyCookie(payload); !ok || key != "steve" {
+		t.Errorf("验证 %q 得到 %q, %v", payload, key, ok)
+	}
+	if _, ok := other.verifyCookie(payload); ok {
+		t.Error("其他密钥签名的Cookie不应该通过")
+	}
+	// 记录键中可以有点，签名在最后一个点之后
+	if key, ok := s.verifyCookie(s.signCookie("a.b")); !ok || key != "a.b" {
+		t.Errorf("带点的记录键验证得到 %q, %v", key, ok)
+	}
+
+	tampered := append([]byte("alex"), payload[len("steve"):]...)
+	for _, bad := range [][]byte{nil, []byte("steve"), payload[len("steve"):], payload[:len(payload)-1], tampered} {
+		if _, ok := s.verifyCookie(bad); ok {
+			t.Errorf("%q 不应该通过验证", bad)
+		}
+	}
+}
+
+func TestCookieSecret(t *testing.T) {
+	cfg := cookieConfig(t)
+	s := &Server{Config: &cfg}
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.cookieSecret) != 64 || string(s.cookieSecret) != s.store.CookieSecret {
+		t.Fatalf("生成的密钥为 %q，存储中为 %q", s.cookieSecret, s.store.CookieSecret)
+	}
+	secret := string(s.cookieSecret)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新启动后使用存储中的密钥，以前保存的Cookie仍然有效
+	again := &Server{Config: &cfg}
+	if err := again.load(); err != nil {
+		t.Fatal(err)
+	}
+	if string(again.cookieSecret) != secret {
+		t.Errorf("重新加载后密钥为 %q，应为 %q", again.cookieSecret, secret)
+	}
+
+	// 配置中的密钥优先，不会生成新的密钥
+	configured := cookieConfig(t)
+	configured.Cookies.Secret = "configured"
+	s = &Server{Config: &configured}
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if string(s.cookieSecret) != "configured" || s.store.CookieSecret != "" {
+		t.Errorf("密钥为 %q，存储中为 %q", s.cookieSecret, s.store.CookieSecret)
+	}
+
+	disabled := cookieConfig(t)
+	disabled.Cookies.Enabled = false
+	s = &Server{Config: &disabled}
+	if err := s.load(); err != nil {
+		t.Fatal(err)
+	}
+	if s.store.CookieSecret != "" {
+		t.Error("没有开启Cookie时不应该生成密钥")
+	}
+}
+
+// 读取服务器的Cookie请求并回复，payload 为 nil 时回复没有这个Cookie
+func answerCookieRequest(t *testing.T, client *packetConn, payload []byte) {
+	t.Helper()
+	id, data, err := client.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != loginCookieRequestID {
+		t.Fatalf("收到数据包 0x%02X，应为Cookie请求", id)
+	}
+	if key, err := readString(bytes.NewReader(data)); err != nil || key != cookieKey {
+		t.Fatalf("请求的Cookie为 %q, %v", key, err)
+	}
+
+	response := new(bytes.Buffer)
+	writeString(response, cookieKey)
+	if payload == nil {
+		response.WriteByte(0)
+	} else {
+		response.WriteByte(1)
+		writeVarInt(response, len(payload))
+		response.Write(payload)
+	}
+	if err := client.writePacket(loginCookieResponseID, response.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 完成登录并进入配置阶段，返回服务器保存的Cookie
+func readStoredCookie(t *testing.T, client *packetConn) []byte {
+	t.Helper()
+	id, _, err := client.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != loginSuccessID {
+		t.Fatalf("收到数据包 0x%02X，应为Login Success", id)
+	}
+	if err := client.writePacket(loginAcknowledgedID, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	id, data, err := client.readPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != configStoreCookieID {
+		t.Fatalf("收到数据包 0x%02X，应为保存Cookie", id)
+	}
+	r := bytes.NewReader(data)
+	if key, err := readString(r); err != nil || key != cookieKey {
+		t.Fatalf("保存的Cookie为 %q, %v", key, err)
+	}
+	payload, err := readByteArray(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func TestCookieLogin(t *testing.T) {
+	cfg := cookieConfig(t)
+	server, addr := startTestServer(t, cfg)
+	linkedTo := func(name string) string {
+		server.store.mu.Lock()
+		defer server.store.mu.Unlock()
+		return server.store.Links[playerKey(name, nil)]
+	}
+
+	// 第一次登录没有Cookie，进入配置阶段后保存签名的记录键
+	client := dialLogin(t, addr, protocol1_21, "Steve")
+	answerCookieRequest(t, client, nil)
+	payload := readStoredCookie(t, client)
+	if key, ok := server.verifyCookie(payload); !ok || key != playerKey("Steve", nil) {
+		t.Fatalf("保存的Cookie为 %q", payload)
+	}
+
+	// 换名称登录时带着Cookie，关联到原来的记录
+	client = dialLogin(t, addr, protocol1_21, "Alex")
+	answerCookieRequest(t, client, payload)
+	if got := readStoredCookie(t, client); !bytes.Equal(got, payload) {
+		t.Errorf("关联之后保存的Cookie为 %q，应为原来的 %q", got, payload)
+	}
+	if got := linkedTo("Alex"); got != playerKey("Steve", nil) {
+		t.Errorf("Alex 关联到 %q，应为 Steve 的记录", got)
+	}
+
+	// 签名不对的Cookie被忽略
+	forged := append([]byte(nil), payload...)
+	forged[len(forged)-1] ^= 1
+	client = dialLogin(t, addr, protocol1_21, "Herobrine")
+	answerCookieRequest(t, client, forged)
+	if got := readStoredCookie(t, client); bytes.Equal(got, payload) {
+		t.Error("签名错误的Cookie不应该关联到原来的记录")
+	}
+	if got := linkedTo("Herobrine"); got != "" {
+		t.Errorf("Herobrine 关联到 %q", got)
+	}
+}
+
+func TestCookieResponseInvalid(t *testing.T) {
+	cfg := cookieConfig(t)
+	_, addr := startTestServer(t, cfg)
+
+	// 长度超过剩余的数据
+	client := dialLogin(t, addr, protocol1_21, "Steve")
+	id, _, err := client.readPacket()
+	if err != nil || id != loginCookieRequestID {
+		t.Fatalf("收到数据包 0x%02X, %v，应为Cookie请求", id, err)
+	}
+	response := new(bytes.Buffer)
+	writeString(response, cookieKey)
+	response.WriteByte(1)
+	writeVarInt(response, 100)
+	response.WriteString("short")
+	if err := client.writePacket(loginCookieResponseID, response.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.readPacket(); err == nil {
+		t.Error("Cookie长度错误时应该断开连接")
+	}
+}
@@ -0,0 +1,102 @@
+package fakeban
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// 每个玩家最多保留的登录时间
+const maxAttempts = 64
+
+// 生成新的封禁ID，8位大写十六进制
+func newBanID() string {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		// 随机数不可用时按时间生成，只用于显示
+		now := time.Now().UnixNano()
+		id = []byte{byte(now >> 24), byte(now >> 16), byte(now >> 8), byte(now)}
+	}
+	return strings.ToUpper(hex.EncodeToString(id))
+}
+
+// 记录一次登录并按配置升级封禁，返回是否升了级，调用方持有存储的锁
+// 距离上一次登录超过 quiet_seconds 时从头开始计数
+func escalate(record *playerRecord, policy EscalationConfig, now time.Time) bool {
+	if n := len(record.Attempts); n > 0 && now.Sub(record.Attempts[n-1]) > time.Duration(policy.QuietSeconds)*time.Second {
+		record.Attempts = nil
+		record.BanLevel = 0
+	}
+	record.Attempts = append(record.Attempts, now)
+	if len(record.Attempts) > maxAttempts {
+		record.Attempts = record.Attempts[len(record.Attempts)-maxAttempts:]
+	}
+
+	level := record.BanLevel
+	for i, step := range escalationSteps(policy) {
+		if i+1 > level && countAttempts(record.Attempts, now, step.WithinSeconds) >= step.Attempts {
+			level = i + 1
+		}
+	}
+	if level <= record.BanLevel {
+		return false
+	}
+	record.BanLevel = level
+	record.BanID = newBanID()
+	return true
+}
+
+// 最近 seconds 秒内的登录次数，seconds 为0时返回全部次数
+func countAttempts(attempts []time.Time, now time.Time, seconds int) int {
+	if seconds <= 0 {
+		return len(attempts)
+	}
+	since := now.Add(-time.Duration(seconds) * time.Second)
+	count := 0
+	for _, attempt := range attempts {
+		if !attempt.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// 没有配置 escalation.steps 时使用的级别
+// 不放在默认配置中，否则配置文件中的级别会和默认的级别逐个合并
+var defaultEscalationSteps = []EscalationStep{
+	{Attempts: 3, WithinSeconds: 600, Message: "ban_evasion", Reason: "ban_evasion_reason"},
+}
+
+func escalationSteps(policy EscalationConfig) []EscalationStep {
+	if policy.Steps == nil {
+		return defaultEscalationSteps
+	}
+	return policy.Steps
+}
+
+// 级别对应的升级封禁设置，没有升级时返回 false
+func escalationStep(policy EscalationConfig, level int) (EscalationStep, bool) {
+	steps := escalationSteps(policy)
+	if level <= 0 || level > len(steps) {
+		return EscalationStep{}, false
+	}
+	return steps[level-1], true
+}
+
+// 检查升级封禁的配置，quiet_seconds 为0时每次登录都会清零，永远升不了级
+// 每个玩家只保留 maxAttempts 次登录，要求更多次数的级别也永远达不到
+func checkEscalation(policy EscalationConfig) error {
+	if policy.QuietSeconds <= 0 {
+		return newError("err.escalation_quiet")
+	}
+	for i, step := range policy.Steps {
+		if step.Attempts <= 0 {
+			return newError("err.escalation_attempts", i+1)
+		}
+		if step.Attempts > maxAttempts {
+			return newError("err.escalation_too_many", i+1, maxAttempts)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package fakeban
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountAttempts(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	attempts := []time.Time{
+		now.Add(-time.Hour),
+		now.Add(-10 * time.Minute),
+		now.Add(-5 * time.Minute),
+		now,
+	}
+	tests := []struct {
+		seconds int
+		want    int
+	}{
+		{0, 4},
+		{-1, 4},
+		{60, 1},
+		{300, 2}, // 正好 seconds 秒之前的登录也算
+		{600, 3},
+		{7200, 4},
+	}
+	for _, tt := range tests {
+		if got := countAttempts(attempts, now, tt.seconds); got != tt.want {
+			t.Errorf("%d 秒内的登录次数为 %d，应为 %d", tt.seconds, got, tt.want)
+		}
+	}
+	if got := countAttempts(nil, now, 600); got != 0 {
+		t.Errorf("没有登录时为 %d，应为 0", got)
+	}
+}
+
+func TestEscalate(t *testing.T) {
+	policy := EscalationConfig{
+		QuietSeconds: 1800,
+		Steps: []EscalationStep{
+			{Attempts: 3, WithinSeconds: 600},
+			{Attempts: 5},
+		},
+	}
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	record := &playerRecord{Name: "Steve", BanID: "00000000"}
+
+	// 每分钟登录一次：第3次升到1级，第5次升到2级，之后不再升级
+	wantLevels := []int{0, 0, 1, 1, 2, 2}
+	banID := record.BanID
+	for i, want := range wantLevels {
+		escalated := escalate(record, policy, start.Add(time.Duration(i)*time.Minute))
+		if record.BanLevel != want {
+			t.Fatalf("第 %d 次登录后级别为 %d，应为 %d", i+1, record.BanLevel, want)
+		}
+		changed := record.BanID != banID
+		if escalated != changed {
+			t.Errorf("第 %d 次登录返回 %v，封禁ID是否改变为 %v", i+1, escalated, changed)
+		}
+		if escalated && (i == 0 || wantLevels[i-1] == want) {
+			t.Errorf("第 %d 次登录没有升级却返回 true", i+1)
+		}
+		banID = record.BanID
+	}
+
+	// 安静超过 quiet_seconds 之后级别和次数清零，封禁ID保留
+	if escalate(record, policy, start.Add(time.Hour)) {
+		t.Error("安静之后的第一次登录不应该升级")
+	}
+	if record.BanLevel != 0 || len(record.Attempts) != 1 {
+		t.Errorf("清零后级别为 %d，次数为 %d，应为 0 和 1", record.BanLevel, len(record.Attempts))
+	}
+	if record.BanID != banID {
+		t.Error("清零时不应该换封禁ID")
+	}
+}
+
+func TestEscalateWindow(t *testing.T) {
+	policy := EscalationConfig{QuietSeconds: 1800, Steps: []EscalationStep{{Attempts: 3, WithinSeconds: 600}}}
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	record := &playerRecord{}
+
+	// 每6分钟登录一次，10分钟内最多两次
+	for i := 0; i < 5; i++ {
+		if escalate(record, policy, start.Add(time.Duration(i)*6*time.Minute)) {
+			t.Fatalf("第 %d 次登录不应该升级", i+1)
+		}
+	}
+	if !escalate(record, policy, start.Add(24*time.Minute+time.Second)) {
+		t.Error("10分钟内第3次登录应该升级")
+	}
+}
+
+func TestEscalateKeepsRecentAttempts(t *testing.T) {
+	policy := EscalationConfig{QuietSeconds: 1800, Steps: []EscalationStep{{Attempts: maxAttempts}}}
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	record := &playerRecord{}
+
+	for i := 0; i < maxAttempts+10; i++ {
+		escalate(record, policy, start.Add(time.Duration(i)*time.Second))
+	}
+	if len(record.Attempts) != maxAttempts {
+		t.Errorf("保留了 %d 次登录，应为 %d", len(record.Attempts), maxAttempts)
+	}
+	if want := start.Add(time.Duration(maxAttempts+9) * time.Second); !record.Attempts[maxAttempts-1].Equal(want) {
+		t.Errorf("最后一次登录为 %v，应为 %v", record.Attempts[maxAttempts-1], want)
+	}
+	if record.BanLevel != 1 {
+		t.Errorf("级别为 %d，应为 1", record.BanLevel)
+	}
+}
+
+func TestCheckEscalation(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy EscalationConfig
+		ok     bool
+	}{
+		{"默认配置", DefaultConfig().Escalation, true},
+		{"quiet_seconds 为0", EscalationConfig{Steps: []EscalationStep{{Attempts: 3}}}, false},
+		{"attempts 为0", EscalationConfig{QuietSeconds: 60, Steps: []EscalationStep{{WithinSeconds: 60}}}, false},
+		{"attempts 正好是上限", EscalationConfig{QuietSeconds: 60, Steps: []EscalationStep{{Attempts: maxAttempts}}}, true},
+		{"attempts 超过上限", EscalationConfig{QuietSeconds: 60, Steps: []EscalationStep{{Attempts: maxAttempts + 1}}}, false},
+		{"有时间窗口也不能超过上限", EscalationConfig{QuietSeconds: 60, Steps: []EscalationStep{{Attempts: 100, WithinSeconds: 60}}}, false},
+	}
+	for _, tt := range tests {
+		if err := checkEscalation(tt.policy); (err == nil) != tt.ok {
+			t.Errorf("%s: 错误为 %v", tt.name, err)
+		}
+	}
+}
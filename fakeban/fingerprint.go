@@ -0,0 +1,256 @@
+package fakeban
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 客户端连接方式
+const (
+	entryServerList    = "server_list"    // 多人游戏列表刷新：状态请求后紧跟ping
+	entryStatusOnly    = "status_only"    // 只有状态请求
+	entryListJoin      = "list_join"      // 最近刷新过服务器列表后加入
+	entryDirectConnect = "direct_connect" // 没有刷新过服务器列表直接连接
+	entryNone          = "none"
+)
+
+// 服务器列表刷新之后多久内的登录算作从列表加入
+const listJoinWindow = 5 * time.Minute
+
+// 客户端指纹，根据握手内容和数据包时序尽量推测客户端类型
+type ClientFingerprint struct {
+	Client string `json:"client"`
+	Entry  string `json:"entry"`
+	FML    string `json:"fml,omitempty"`
+	// 配置阶段客户端发送的品牌，只有开启 configuration 的1.20.2及以上版本才有
+	Brand    string `json:"brand,omitempty"`
+	HostKind string `json:"host_kind"`
+	// 数据包顺序，例如 handshake,status,ping
+	Order string `json:"order"`
+	// 握手包之后下一个数据包到达的间隔
+	HandshakeGapMillis int64 `json:"handshake_gap_millis"`
+	// 状态响应发送之后ping到达的间隔
+	PingGapMillis int64  `json:"ping_gap_millis"`
+	PingPayload   string `json:"ping_payload,omitempty"`
+}
+
+func (f ClientFingerprint) String() string {
+	s := f.Client + "/" + f.Entry
+	if f.FML != "" {
+		s += "/" + f.FML
+	}
+	return s
+}
+
+// 配置的客户端特征，所有填写了的条件都满足时匹配
+type ClientSignature struct {
+	Client          string `json:"client"`
+	HostnamePattern string `json:"hostname_pattern"`
+	Protocols       []int  `json:"protocols"`
+	PingPayload     string `json:"ping_payload"`
+	Entry           string `json:"entry"`
+	// 客户端品牌，正则表达式
+	BrandPattern string `json:"brand_pattern"`
+
+	hostname *regexp.Regexp
+	brand    *regexp.Regexp
+}
+
+// 内置的客户端特征，排在配置的特征之后
+// 第三方客户端在握手中没有标记，只能按配置阶段的品牌区分，例如 lunarclient:1.21-a1b2c3d
+var builtinClientSignatures = []ClientSignature{
+	{Client: "lunar", BrandPattern: `(?i)^lunarclient`},
+	{Client: "badlion", BrandPattern: `(?i)badlion`},
+	{Client: "feather", BrandPattern: `(?i)feather`},
+	{Client: "forge", BrandPattern: `(?i)^(neo)?forge|^fml`},
+	{Client: "fabric", BrandPattern: `(?i)^(fabric|quilt)`},
+	{Client: "vanilla", BrandPattern: `^vanilla$`},
+}
+
+// 编译配置的特征，内置的特征追加在后面
+func compileClientSignatures(signatures []ClientSignature) ([]ClientSignature, error) {
+	all := make([]ClientSignature, 0, len(signatures)+len(builtinClientSignatures))
+	all = append(all, signatures...)
+	all = append(all, builtinClientSignatures...)
+
+	compiled := make([]ClientSignature, len(all))
+	for i, sig := range all {
+		if sig.HostnamePattern != "" {
+			re, err := regexp.Compile(sig.HostnamePattern)
+			if err != nil {
+				return nil, newError("err.signature_hostname", sig.Client, sig.HostnamePattern, err)
+			}
+			sig.hostname = re
+		}
+		if sig.BrandPattern != "" {
+			re, err := regexp.Compile(sig.BrandPattern)
+			if err != nil {
+				return nil, newError("err.signature_brand", sig.Client, sig.BrandPattern, err)
+			}
+			sig.brand = re
+		}
+		compiled[i] = sig
+	}
+	return compiled, nil
+}
+
+func (sig ClientSignature) match(f ClientFingerprint, handshake *Handshake) bool {
+	if sig.hostname != nil && !sig.hostname.MatchString(handshake.ServerAddress) {
+		return false
+	}
+	if sig.brand != nil && (f.Brand == "" || !sig.brand.MatchString(f.Brand)) {
+		return false
+	}
+	if len(sig.Protocols) > 0 {
+		found := false
+		for _, protocol := range sig.Protocols {
+			if protocol == handshake.ProtocolVersion {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if sig.PingPayload != "" && sig.PingPayload != f.PingPayload {
+		return false
+	}
+	if sig.Entry != "" && sig.Entry != f.Entry {
+		return false
+	}
+	return true
+}
+
+// 连接中的一个事件
+type connEvent struct {
+	Name string
+	At   time.Time
+}
+
+// 记录事件发生的时间
+func (o *connObservation) mark(name string) {
+	o.Events = append(o.Events, connEvent{Name: name, At: time.Now()})
+}
+
+func (o *connObservation) eventTime(name string) (time.Time, bool) {
+	for _, e := range o.Events {
+		if e.Name == name {
+			return e.At, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// 根据目前观察到的内容生成客户端指纹，signatures 是编译后的客户端特征
+func (o *connObservation) clientFingerprint(signatures []ClientSignature) ClientFingerprint {
+	f := ClientFingerprint{Client: "unknown", Entry: entryNone}
+	if o.Handshake == nil {
+		return f
+	}
+
+	f.HostKind = hostKind(cleanHostname(o.Handshake.ServerAddress))
+	f.FML = fmlMarker(o.Handshake.ServerAddress)
+	f.Brand = o.Brand
+
+	names := make([]string, len(o.Events))
+	for i, e := range o.Events {
+		names[i] = e.Name
+	}
+	f.Order = strings.Join(names, ",")
+
+	if len(o.Events) > 1 {
+		f.HandshakeGapMillis = o.Events[1].At.Sub(o.Events[0].At).Milliseconds()
+	}
+	sent, okSent := o.eventTime("status_sent")
+	pinged, okPinged := o.eventTime("ping")
+	if okSent && okPinged {
+		f.PingGapMillis = pinged.Sub(sent).Milliseconds()
+	}
+	if o.Pinged {
+		f.PingPayload = pingPayloadKind(o.PingPayload, pinged)
+	}
+
+	switch {
+	case o.Login && o.listJoin:
+		f.Entry = entryListJoin
+	case o.Login:
+		f.Entry = entryDirectConnect
+	case o.Status && o.Pinged:
+		f.Entry = entryServerList
+	case o.Status:
+		f.Entry = entryStatusOnly
+	}
+
+	// 没有匹配的特征时：握手中有Forge标记的是forge，发送了未知品牌的是other
+	switch {
+	case f.FML != "":
+		f.Client = "forge"
+	case f.Brand != "":
+		f.Client = "other"
+	default:
+		f.Client = "vanilla"
+	}
+	for _, sig := range signatures {
+		if sig.match(f, o.Handshake) {
+			f.Client = sig.Client
+			break
+		}
+	}
+	return f
+}
+
+// Forge客户端会在握手地址后面追加\0FML\0、\0FML2\0、\0FML3\0或\0FORGE标记
+func fmlMarker(address string) string {
+	parts := strings.Split(address, "\x00")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// ping负载的类型：原版客户端发送的是单调时钟毫秒数，部分工具发送0或者当前时间戳
+func pingPayloadKind(payload int64, received time.Time) string {
+	switch {
+	case payload == 0:
+		return "zero"
+	case payload > received.Add(-24*time.Hour).UnixMilli() && payload < received.Add(24*time.Hour).UnixMilli():
+		return "epoch"
+	default:
+		return "monotonic"
+	}
+}
+
+// 最近刷新过服务器列表的IP，用来区分从列表加入和直接连接
+type listPings struct {
+	sync.Mutex
+	at map[string]time.Time
+}
+
+func (p *listPings) record(ip string) {
+	p.Lock()
+	defer p.Unlock()
+
+	now := time.Now()
+	if p.at == nil {
+		p.at = make(map[string]time.Time)
+	}
+	p.at[ip] = now
+	if len(p.at) > 4096 {
+		for k, t := range p.at {
+			if now.Sub(t) > listJoinWindow {
+				delete(p.at, k)
+			}
+		}
+	}
+}
+
+func (p *listPings) recent(ip string) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	t, ok := p.at[ip]
+	return ok && time.Since(t) <= listJoinWindow
+}
@@ -0,0 +1,269 @@
+package fakeban
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 登录阶段的数据包ID
+const (
+	loginPluginRequestID  = 0x04 // 服务端 -> 客户端
+	loginPluginResponseID = 0x02 // 客户端 -> 服务端
+)
+
+// FML登录握手使用的插件频道
+const (
+	fmlLoginWrapperChannel = "fml:loginwrapper"
+	fmlHandshakeChannel    = "fml:handshake"
+)
+
+// fml:handshake 中的消息ID
+const (
+	fmlServerModListID = 1
+	fmlClientModListID = 2
+)
+
+// 等待客户端回复模组列表的时间
+const forgeReplyTimeout = 5 * time.Second
+
+// 发送给客户端的Forge自带频道，客户端会检查这些频道的版本
+var forgeChannels = map[string][][2]string{
+	"FML2": {
+		{"fml:loginwrapper", "FML2"},
+		{"fml:handshake", "FML2"},
+		{"fml:play", "FML2"},
+		{"forge:tier_sorting", "1.0"},
+	},
+	"FML3": {
+		{"fml:loginwrapper", "FML3"},
+		{"fml:handshake", "FML3"},
+		{"fml:play", "FML3"},
+		{"forge:tier_sorting", "1.0"},
+		{"forge:split", "1.1"},
+	},
+}
+
+// 模组ID和版本，版本取自同名命名空间的网络频道，可能为空
+type ForgeMod struct {
+	ID      string `json:"id"`
+	Version string `json:"version,omitempty"`
+}
+
+// 客户端回复的模组列表
+type forgeModList struct {
+	Mods       []string
+	Channels   map[string]string
+	Registries map[string]string
+}
+
+// 1.13到1.20.1的Forge客户端在登录阶段交换模组列表，更早的版本要到游戏阶段才交换
+func forgeLoginHandshake(handshake *Handshake) bool {
+	_, ok := forgeChannels[fmlMarker(handshake.ServerAddress)]
+	return ok
+}
+
+// 登录插件请求的消息ID，用来对应客户端的回复
+const forgeMessageID = 1
+
+// 发送服务端模组列表，客户端的回复由 handleLoginPluginResponse 处理
+func requestForgeModList(c *connection, marker string) error {
+	request := new(bytes.Buffer)
+	writeVarInt(request, forgeMessageID)
+	writeString(request, fmlLoginWrapperChannel)
+	writeFMLWrapped(request, fmlServerModListID, serverModList(marker))
+
+	if err := c.writePacket(loginPluginRequestID, request.Bytes()); err != nil {
+		return err
+	}
+	c.forgeMarker = marker
+
+	// 客户端没有回复时照常发送封禁消息
+	c.await(forgeReplyTimeout, func(c *connection) error {
+		c.server.logf("log.forge_timeout")
+		c.forgeMarker = ""
+		return completeLogin(c)
+	})
+	return nil
+}
+
+func handleLoginPluginResponse(c *connection, data []byte) error {
+	r := bytes.NewReader(data)
+	id, err := readVarInt(r)
+	if err != nil {
+		return err
+	}
+	if id != forgeMessageID || c.forgeMarker == "" {
+		return nil
+	}
+	c.stopWaiting()
+	c.forgeMarker = ""
+
+	mods, err := readForgeReply(r)
+	if err != nil {
+		c.server.logf("log.forge_reply_error", err)
+	} else {
+		c.mods = mods
+		c.server.logf("log.forge_mods", c.obs.Player, strings.Join(mods.ids(), ","))
+	}
+	return completeLogin(c)
+}
+
+func readForgeReply(r *bytes.Reader) (*forgeModList, error) {
+	successful, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if successful == 0 {
+		return nil, newError("err.forge_unsupported")
+	}
+	return readClientModList(r)
+}
+
+// 服务端的模组列表：没有模组，只有Forge自带的频道
+func serverModList(marker string) []byte {
+	buf := new(bytes.Buffer)
+
+	writeVarInt(buf, 1)
+	writeString(buf, "forge")
+
+	channels := forgeChannels[marker]
+	writeVarInt(buf, len(channels))
+	for _, channel := range channels {
+		writeString(buf, channel[0])
+		writeString(buf, channel[1])
+	}
+
+	// 注册表
+	writeVarInt(buf, 0)
+	if marker == "FML3" {
+		// 数据包注册表
+		writeVarInt(buf, 0)
+	}
+	return buf.Bytes()
+}
+
+// 把fml:handshake消息包装成fml:loginwrapper的格式
+func writeFMLWrapped(w io.Writer, messageID int, payload []byte) {
+	inner := new(bytes.Buffer)
+	writeVarInt(inner, messageID)
+	inner.Write(payload)
+
+	writeString(w, fmlHandshakeChannel)
+	writeVarInt(w, inner.Len())
+	w.Write(inner.Bytes())
+}
+
+func readClientModList(r *bytes.Reader) (*forgeModList, error) {
+	channel, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	if channel != fmlHandshakeChannel {
+		return nil, newError("err.fml_channel", channel)
+	}
+	if _, err := readVarInt(r); err != nil {
+		return nil, err
+	}
+
+	messageID, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if messageID != fmlClientModListID {
+		return nil, newError("err.fml_message", messageID)
+	}
+
+	list := &forgeModList{
+		Channels:   make(map[string]string),
+		Registries: make(map[string]string),
+	}
+
+	count, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < count; i++ {
+		mod, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		list.Mods = append(list.Mods, mod)
+	}
+
+	if err := readStringPairs(r, list.Channels); err != nil {
+		return nil, err
+	}
+	if err := readStringPairs(r, list.Registries); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func readStringPairs(r io.Reader, into map[string]string) error {
+	count, err := readVarInt(r)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		key, err := readString(r)
+		if err != nil {
+			return err
+		}
+		value, err := readString(r)
+		if err != nil {
+			return err
+		}
+		into[key] = value
+	}
+	return nil
+}
+
+func (m *forgeModList) ids() []string {
+	if m == nil {
+		return nil
+	}
+	return m.Mods
+}
+
+// 模组列表和从频道推测出的版本
+func (m *forgeModList) list() []ForgeMod {
+	if m == nil {
+		return nil
+	}
+	channels := make([]string, 0, len(m.Channels))
+	for channel := range m.Channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	mods := make([]ForgeMod, 0, len(m.Mods))
+	for _, id := range m.Mods {
+		mod := ForgeMod{ID: id}
+		for _, channel := range channels {
+			if strings.HasPrefix(channel, id+":") {
+				mod.Version = m.Channels[channel]
+				break
+			}
+		}
+		mods = append(mods, mod)
+	}
+	return mods
+}
+
+// 返回第一个在作弊模组列表中的模组ID，不区分大小写
+func (m *forgeModList) cheatMod(cheatMods []string) string {
+	if m == nil {
+		return ""
+	}
+	for _, id := range m.Mods {
+		for _, cheat := range cheatMods {
+			if strings.EqualFold(id, cheat) {
+				return id
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package fakeban
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/numakkiyu/FakeHypixelBan/mmdb"
+)
+
+// GeoLocation 从本地IP数据库查到的位置，没有数据库或查不到时为空
+type GeoLocation struct {
+	// 国家的ISO代码，例如 DE
+	Country     string `json:"country,omitempty"`
+	CountryName string `json:"country_name,omitempty"`
+	City        string `json:"city,omitempty"`
+	// IANA时区，例如 Europe/Berlin
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// 本地的MaxMind格式IP数据库，文件修改后自动重新读取
+type geoDatabase struct {
+	mu      sync.RWMutex
+	path    string
+	reader  *mmdb.Reader
+	modTime time.Time
+	size    int64
+	// 读取了新文件时输出日志
+	logf func(key string, args ...any)
+}
+
+// 读取IP数据库，路径为空时不查询位置
+func loadGeoIP(path string, logf func(key string, args ...any)) (*geoDatabase, error) {
+	g := &geoDatabase{path: path, logf: logf}
+	if path == "" {
+		return g, nil
+	}
+	if _, err := g.reload(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// 文件的修改时间或大小变化时重新读取，返回是否读取了新文件
+func (g *geoDatabase) reload() (bool, error) {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return false, err
+	}
+
+	g.mu.RLock()
+	unchanged := g.reader != nil && info.ModTime().Equal(g.modTime) && info.Size() == g.size
+	g.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	reader, err := mmdb.Open(g.path)
+	if err != nil {
+		return false, err
+	}
+	g.mu.Lock()
+	g.reader = reader
+	g.modTime = info.ModTime()
+	g.size = info.Size()
+	g.mu.Unlock()
+
+	g.logf("log.geoip_loaded", g.path, reader.Metadata.DatabaseType,
+		time.Unix(int64(reader.Metadata.BuildEpoch), 0).Format(time.DateOnly))
+	return true, nil
+}
+
+// 查询IP的位置，查不到时返回空值
+func (g *geoDatabase) lookup(ip string) GeoLocation {
+	g.mu.RLock()
+	reader := g.reader
+	g.mu.RUnlock()
+
+	parsed := net.ParseIP(ip)
+	if reader == nil || parsed == nil {
+		return GeoLocation{}
+	}
+	record, err := reader.Lookup(parsed)
+	if err != nil || record == nil {
+		return GeoLocation{}
+	}
+
+	// GeoLite2-City 有城市和时区，GeoLite2-Country 只有国家
+	return GeoLocation{
+		Country:     lookupString(record, "country", "iso_code"),
+		CountryName: lookupString(record, "country", "names", "en"),
+		City:        lookupString(record, "city", "names", "en"),
+		TimeZone:    lookupString(record, "location", "time_zone"),
+	}
+}
+
+// 按路径取出嵌套的字符串，不存在时为空
+func lookupString(value any, path ...string) string {
+	for _, key := range path {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		value = m[key]
+	}
+	s, _ := value.(string)
+	return s
+}
@@ -0,0 +1,318 @@
+package fakeban
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// 内置的消息目录，每种语言一个文件
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// 没有其他可用语言时使用
+const fallbackLocale = "en_us"
+
+// 默认的控制台语言，没有 Server 时的日志和错误信息也使用这种语言
+const defaultConsoleLocale = "zh_cn"
+
+// 控制台日志和错误信息的键以这两个前缀开头，内容是 fmt 格式字符串，其他键是 text/template 模板
+const (
+	logPrefix   = "log."
+	errorPrefix = "err."
+)
+
+// Message 一条消息，配置中可以写成一个字符串，也可以写成按顺序拼接的多行
+type Message []string
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*m = Message{text}
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return err
+	}
+	*m = lines
+	return nil
+}
+
+func (m Message) String() string {
+	return strings.Join(m, "")
+}
+
+// 一种语言的消息目录
+type catalogue struct {
+	messages  map[string]string
+	templates map[string]*template.Template
+}
+
+// 所有语言的消息目录，键是小写的语言代码，例如 en_us
+type catalogueSet map[string]*catalogue
+
+// 内置的消息目录，没有配置覆盖，Server 读取配置之前和 Logf 使用
+var builtinCatalogues = mustLoadCatalogues()
+
+func mustLoadCatalogues() catalogueSet {
+	loaded, err := loadCatalogues(nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+// 读取内置的消息目录，再用配置中的消息覆盖
+// banLines 不为空时替换所有语言的封禁消息，兼容旧的 ban.lines 配置
+func loadCatalogues(overrides map[string]map[string]Message, banLines []string) (catalogueSet, error) {
+	messages := make(map[string]map[string]string)
+
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := localeFiles.ReadFile("locales/" + file.Name())
+		if err != nil {
+			return nil, err
+		}
+		var entries map[string]Message
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		locale := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
+		messages[locale] = make(map[string]string)
+		for key, message := range entries {
+			messages[locale][key] = message.String()
+		}
+	}
+
+	// 预设只有英文，其他语言使用英文
+	for name, preset := range presets {
+		messages[fallbackLocale][presetKey(name, "motd")] = preset.MOTD.String()
+		messages[fallbackLocale][presetKey(name, "message")] = preset.Message.String()
+	}
+
+	for locale, entries := range overrides {
+		locale = normalizeLocale(locale)
+		if messages[locale] == nil {
+			messages[locale] = make(map[string]string)
+		}
+		for key, message := range entries {
+			messages[locale][key] = message.String()
+		}
+	}
+	if len(banLines) > 0 {
+		for locale := range messages {
+			messages[locale]["ban"] = strings.Join(banLines, "")
+		}
+	}
+
+	loaded := make(catalogueSet)
+	for locale, entries := range messages {
+		c := &catalogue{messages: entries, templates: make(map[string]*template.Template)}
+		for key, text := range entries {
+			if strings.HasPrefix(key, logPrefix) || strings.HasPrefix(key, errorPrefix) {
+				continue
+			}
+			tmpl, err := template.New(key).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", locale, key, err)
+			}
+			c.templates[key] = tmpl
+		}
+		loaded[locale] = c
+	}
+	return loaded, nil
+}
+
+// 语言代码统一为小写加下划线，例如 zh-CN -> zh_cn
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "-", "_"))
+}
+
+// 找到对应的消息目录，没有完全相同的语言时使用同一语种的其他地区
+func (cs catalogueSet) match(locale string) string {
+	locale = normalizeLocale(locale)
+	if locale == "" {
+		return ""
+	}
+	if _, ok := cs[locale]; ok {
+		return locale
+	}
+
+	language, _, _ := strings.Cut(locale, "_")
+	names := make([]string, 0, len(cs))
+	for name := range cs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == language || strings.HasPrefix(name, language+"_") {
+			return name
+		}
+	}
+	return ""
+}
+
+// 按顺序选择第一个有消息目录的语言，都没有时使用默认语言
+// 登录时的顺序是：客户端设置的语言、玩家记录中的语言、主机名对应的语言、国家对应的语言
+func (s *Server) selectLocale(candidates ...string) string {
+	for _, candidate := range candidates {
+		if locale := s.catalogues.match(candidate); locale != "" {
+			return locale
+		}
+	}
+	if locale := s.catalogues.match(s.config.Locale.Default); locale != "" {
+		return locale
+	}
+	return fallbackLocale
+}
+
+// 国家对应的语言，没有设置时为空
+func (s *Server) countryLocale(country string) string {
+	return s.config.Locale.Countries[strings.ToUpper(country)]
+}
+
+// 握手地址对应的语言，没有设置时为空
+func (s *Server) hostnameLocale(address string) string {
+	return s.config.Locale.Hostnames[strings.ToLower(cleanHostname(address))]
+}
+
+// 按语言渲染玩家看到的消息，这种语言没有这条消息时使用默认语言
+func (s *Server) renderMessage(locale, key string, data messageData) (string, error) {
+	tmpl := s.lookupTemplate(locale, key)
+	if tmpl == nil {
+		return "", newError("err.no_message", key)
+	}
+	data.AppealURL = s.appealURL(data.Hostname)
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (s *Server) lookupTemplate(locale, key string) *template.Template {
+	for _, name := range []string{locale, s.catalogues.match(s.config.Locale.Default), fallbackLocale} {
+		if c := s.catalogues[name]; c != nil && c.templates[key] != nil {
+			return c.templates[key]
+		}
+	}
+	return nil
+}
+
+// 按语言格式化消息目录中的 fmt 格式字符串，没有这个键时原样输出键
+// 参数中的 localError 也按这种语言输出
+func (cs catalogueSet) format(locale, key string, args ...any) string {
+	format := key
+	for _, name := range []string{cs.match(locale), fallbackLocale} {
+		if c := cs[name]; c != nil {
+			if message, ok := c.messages[key]; ok {
+				format = message
+				break
+			}
+		}
+	}
+	localized := make([]any, len(args))
+	for i, arg := range args {
+		if e, ok := arg.(*localError); ok {
+			arg = cs.format(locale, e.key, e.args...)
+		}
+		localized[i] = arg
+	}
+	return fmt.Sprintf(format, localized...)
+}
+
+// 按控制台语言格式化，读取配置之前使用默认的控制台语言
+func (s *Server) consoleText(key string, args ...any) string {
+	if s.catalogues == nil {
+		return builtinCatalogues.format(defaultConsoleLocale, key, args...)
+	}
+	return s.catalogues.format(s.config.Locale.Console, key, args...)
+}
+
+// 按控制台语言输出日志，设置了 ErrorLog 时写到 ErrorLog
+func (s *Server) logf(key string, args ...any) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Println(s.consoleText(key, args...))
+		return
+	}
+	fmt.Println(s.consoleText(key, args...))
+}
+
+// 按控制台语言输出的错误，key 是消息目录中 err. 开头的键
+// Error 使用默认的控制台语言，Server 输出日志时按配置中的语言
+type localError struct {
+	key  string
+	args []any
+}
+
+func newError(key string, args ...any) error {
+	return &localError{key: key, args: args}
+}
+
+func (e *localError) Error() string {
+	return builtinCatalogues.format(defaultConsoleLocale, e.key, e.args...)
+}
+
+// 参数中的错误可以用 errors.Is 和 errors.As 检查
+func (e *localError) Unwrap() []error {
+	var errs []error
+	for _, arg := range e.args {
+		if err, ok := arg.(error); ok {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Logf 按配置中的控制台语言输出日志，key 是消息目录中 log. 开头的键，设置了 ErrorLog 时写到 ErrorLog
+func (s *Server) Logf(key string, args ...any) {
+	s.logf(key, args...)
+}
+
+// Logf 没有 Server 时按默认的控制台语言输出日志，例如读取配置文件出错
+func Logf(key string, args ...any) {
+	fmt.Println(builtinCatalogues.format(defaultConsoleLocale, key, args...))
+}
+
+// 连接使用的语言：客户端设置的语言、玩家记录中的语言、主机名对应的语言、国家对应的语言
+func (c *connection) locale() string {
+	var client string
+	if c.info != nil {
+		client = c.info.Locale
+	}
+	s := c.server
+	return s.selectLocale(client, c.record.Locale, s.hostnameLocale(c.handshake.ServerAddress),
+		s.countryLocale(c.obs.Geo.Country))
+}
+
+// 按连接已知的信息渲染消息，用于还没有交给 LoginHandler 的断开连接
+func (c *connection) message(key string) DisconnectMessage {
+	return c.server.localizedMessage(c.locale(), key, messageData{
+		Player:      c.obs.Player,
+		IP:          c.obs.IP,
+		Protocol:    c.protocol,
+		Hostname:    cleanHostname(c.handshake.ServerAddress),
+		GeoLocation: c.obs.Geo,
+		Client:      c.obs.clientFingerprint(c.server.clientSignatures),
+	})
+}
+
+// 按语言生成断开连接消息，模板出错时只记录日志
+func (s *Server) localizedMessage(locale, key string, data messageData) DisconnectMessage {
+	data.Locale = locale
+	text, err := s.renderMessage(locale, key, data)
+	if err != nil {
+		s.logf("log.message_error", key, err)
+	}
+	return DisconnectMessage{Text: text}
+}
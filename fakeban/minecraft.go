@@ -0,0 +1,532 @@
+package fakeban
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// 服务器状态响应结构
+type StatusResponse struct {
+	Version     Version     `json:"version"`
+	Players     Players     `json:"players"`
+	Description Description `json:"description"`
+	Favicon     string      `json:"favicon"`
+}
+
+type Version struct {
+	Name     string `json:"name"`
+	Protocol int    `json:"protocol"`
+}
+
+type Players struct {
+	Max    int `json:"max"`
+	Online int `json:"online"`
+}
+
+type Description struct {
+	Text string `json:"text"`
+}
+
+// 握手包内容
+type Handshake struct {
+	ProtocolVersion int
+	ServerAddress   string
+	Port            uint16
+	NextState       int
+}
+
+// 第一个数据包不是握手包时返回，调用方直接关闭连接即可
+var errNotHandshake = newError("err.not_handshake")
+
+func readHandshake(r io.Reader) (Handshake, error) {
+	var handshake Handshake
+
+	_, err := readVarInt(r)
+	if err != nil {
+		return handshake, newError("err.read_handshake_length", err)
+	}
+
+	// 读取数据包ID
+	packetID, err := readVarInt(r)
+	if err != nil {
+		return handshake, newError("err.read_packet_id", err)
+	}
+	if packetID != handshakeID {
+		return handshake, errNotHandshake
+	}
+
+	// 读取协议版本
+	handshake.ProtocolVersion, err = readVarInt(r)
+	if err != nil {
+		return handshake, newError("err.read_protocol", err)
+	}
+
+	// 读取服务器地址
+	handshake.ServerAddress, err = readString(r)
+	if err != nil {
+		return handshake, newError("err.read_address", err)
+	}
+
+	// 读取端口
+	if err := binary.Read(r, binary.BigEndian, &handshake.Port); err != nil {
+		return handshake, newError("err.read_port", err)
+	}
+
+	// 读取下一个状态
+	handshake.NextState, err = readVarInt(r)
+	if err != nil {
+		return handshake, newError("err.read_next_state", err)
+	}
+
+	return handshake, nil
+}
+
+func handleStatusRequest(c *connection, data []byte) error {
+	c.server.logf("log.status_request", statusRequestID)
+	c.obs.Status = true
+	c.obs.mark("status")
+
+	rule := c.selectRule()
+	switch rule.Action {
+	case rulePass:
+		return c.passThrough(statusRequestID, data)
+	case ruleThrottle:
+		c.close()
+		return nil
+	}
+
+	host := c.server.lookupHost(c.handshake.ServerAddress)
+	motd := firstKey(rule.MOTD, host.MOTD)
+	if c.server.config.Reveal.Enabled && c.server.config.Reveal.MOTD != "" && c.server.store.revealedIP(c.obs.IP) {
+		motd = c.server.config.Reveal.MOTD
+	}
+	status := c.server.statusHandler().ServeStatus(&StatusRequest{
+		IP:        c.obs.IP,
+		Handshake: c.handshake,
+		Geo:       c.obs.Geo,
+		Locale:    c.server.selectLocale(c.server.hostnameLocale(c.handshake.ServerAddress), c.server.countryLocale(c.obs.Geo.Country)),
+		Host:      host,
+		Rule:      rule.Name,
+		MOTD:      motd,
+		server:    c.server,
+	})
+	if rule.Action == ruleOutdated {
+		// 协议版本和客户端不同时客户端会把版本显示为红色
+		status.Version.Protocol = -1
+	}
+	status = c.resp.status(status)
+
+	// 将状态转换为JSON
+	jsonStatus, err := json.Marshal(status)
+	if err != nil {
+		return newError("err.json_encode", err)
+	}
+
+	// 发送状态响应
+	response := new(bytes.Buffer)
+	if err := writeString(response, string(jsonStatus)); err != nil {
+		return newError("err.write_json", err)
+	}
+	if err := c.sendPacket(packetStatus, statusResponseID, response.Bytes()); err != nil {
+		return newError("err.send_status", err)
+	}
+	c.obs.mark("status_sent")
+
+	c.server.logf("log.status_sent")
+	return nil
+}
+
+func handlePing(c *connection, data []byte) error {
+	// 读取ping值
+	var pingTime int64
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &pingTime); err != nil {
+		return newError("err.read_ping", err)
+	}
+
+	c.server.logf("log.ping", pingTime)
+	c.obs.Pinged = true
+	c.obs.PingPayload = pingTime
+	c.obs.mark("ping")
+	c.server.listPings.record(c.obs.IP)
+
+	// 发送pong响应，原样返回ping值
+	if err := c.sendPacket(packetPong, pongResponseID, data[:8]); err != nil {
+		return newError("err.send_pong", err)
+	}
+
+	c.server.logf("log.pong_sent")
+	c.close()
+	return nil
+}
+
+func handleLoginStart(c *connection, data []byte) error {
+	// 玩家名称之后的字段随版本变化，这里不需要
+	player, err := readString(bytes.NewReader(data))
+	if err != nil {
+		return newError("err.read_player", err)
+	}
+	c.obs.Player = player
+	c.obs.Login = true
+	c.obs.listJoin = c.server.listPings.recent(c.obs.IP)
+	c.obs.mark("login")
+
+	if passed, err := c.revealedPassThrough(loginStartID, data); passed {
+		return err
+	}
+
+	switch c.selectRule().Action {
+	case rulePass:
+		return c.passThrough(loginStartID, data)
+	case ruleThrottle:
+		c.disconnect(c.message("throttle"))
+		return nil
+	case ruleOutdated:
+		c.disconnect(c.message("outdated"))
+		return nil
+	case ruleTransfer:
+		if transferred, err := c.transferRule(data); transferred || err != nil {
+			return err
+		}
+	}
+
+	if c.protocol < c.server.config.MinProtocol {
+		c.server.logf("log.outdated", player, c.protocol)
+		c.disconnect(c.message("outdated"))
+		return nil
+	}
+
+	// 正版验证，客户端的回复由 handleEncryptionResponse 处理
+	if c.server.config.Auth.OnlineMode {
+		return requestEncryption(c)
+	}
+	return loginVerified(c, nil)
+}
+
+// 玩家身份确认之后，支持Cookie的客户端先读取Cookie
+func loginVerified(c *connection, profile *GameProfile) error {
+	c.profile = profile
+	if c.cookiesEnabled() {
+		return requestCookie(c)
+	}
+	return loginIdentified(c)
+}
+
+// 认出玩家之后：记录玩家、开启压缩，Forge客户端先交换模组列表
+func loginIdentified(c *connection) error {
+	c.recordKey, c.record = c.server.store.recordLogin(c.obs.Player, c.profile, c.obs.IP, c.cookieLink, &c.server.config)
+
+	// 和真正的服务器一样在登录阶段开启压缩
+	if c.server.config.CompressionThreshold >= 0 {
+		if err := c.enableCompression(c.server.config.CompressionThreshold); err != nil {
+			return newError("err.enable_compression", err)
+		}
+	}
+
+	// Forge客户端在登录阶段交换模组列表，回复由 handleLoginPluginResponse 处理
+	if c.server.config.Forge.DetectMods && forgeLoginHandshake(c.obs.Handshake) && c.protocol >= protocol1_13 {
+		if err := requestForgeModList(c, fmlMarker(c.handshake.ServerAddress)); err != nil {
+			c.server.logf("log.forge_request_error", err)
+			return completeLogin(c)
+		}
+		return nil
+	}
+	return completeLogin(c)
+}
+
+// 由 LoginHandler 决定登录的结果
+func finishLogin(c *connection) error {
+	host := c.server.lookupHost(c.handshake.ServerAddress)
+	var packMessage string
+	if c.packSent {
+		packMessage = c.server.config.ResourcePack.Message
+	}
+	appealID, appeal, _ := c.server.store.decidedAppeal(c.recordKey)
+	var linked string
+	if c.recordKey != playerKey(c.obs.Player, c.profile) {
+		linked = c.record.Name
+	}
+	result := c.server.loginHandler().ServeLogin(&LoginRequest{
+		IP:           c.obs.IP,
+		Handshake:    c.handshake,
+		Player:       c.obs.Player,
+		Transferred:  c.handshake.NextState == nextStateTransfer,
+		Profile:      c.profile,
+		LinkedPlayer: linked,
+		Logins:       c.record.Logins,
+		BanID:        c.record.BanID,
+		BanLevel:     c.record.BanLevel,
+		Reveal:       revealState(c.server.config.Reveal, c.record),
+		Appeal:       appeal.Status,
+		AppealID:     appealID,
+		Mods:         c.mods.list(),
+		CheatMod:     c.mods.cheatMod(c.server.config.Forge.CheatMods),
+		Client:       c.obs.clientFingerprint(c.server.clientSignatures),
+		Brand:        c.brand,
+		Info:         c.info,
+		Geo:          c.obs.Geo,
+		Locale:       c.locale(),
+		Host:         host,
+		Rule:         c.rule.Name,
+		Message:      firstKey(c.rule.Message, packMessage, host.Message),
+		ResourcePack: c.packResult,
+		server:       c.server,
+	})
+
+	if revealState(c.server.config.Reveal, c.record) == RevealShow {
+		c.server.store.markRevealShown(c.obs.Player, c.profile)
+	}
+	if appealID != "" {
+		c.server.store.markAppealShown(appealID)
+	}
+
+	// 1.21的客户端在断开连接界面显示服务器链接
+	if result.Disconnect != nil && c.state == stateConfiguration && c.protocol >= protocol1_21 && len(c.server.serverLinks()) > 0 {
+		if err := sendServerLinks(c); err != nil {
+			c.server.logf("log.server_links_error", err)
+		}
+	}
+
+	switch {
+	case result.Transfer != nil:
+		return c.transferTo(result.Transfer)
+	case result.Disconnect != nil:
+		c.disconnect(*result.Disconnect)
+	default:
+		c.close()
+	}
+	return nil
+}
+
+// Hypixel的MOTD信息，描述按语言从消息目录中生成，域名配置中的字段覆盖默认值
+func hypixelStatus(req *StatusRequest) StatusResponse {
+	key := req.MOTD
+	if key == "" {
+		key = "motd"
+	}
+	motd := req.server.localizedMessage(req.Locale, key, messageData{
+		IP:          req.IP,
+		Protocol:    req.Handshake.ProtocolVersion,
+		Hostname:    cleanHostname(req.Handshake.ServerAddress),
+		GeoLocation: req.Geo,
+		Vars:        req.Host.Vars,
+	})
+	status := StatusResponse{
+		Version: Version{
+			Name:     "1.8-1.21",
+			Protocol: 47,
+		},
+		Players: Players{
+			Max:    200000,
+			Online: 25909,
+		},
+		Description: Description{
+			Text: motd.Text,
+		},
+		Favicon: serverIcon,
+	}
+
+	host := req.Host
+	if host.Version != "" {
+		status.Version.Name = host.Version
+	}
+	if host.Protocol != 0 {
+		status.Version.Protocol = host.Protocol
+	}
+	if host.MaxPlayers != 0 {
+		status.Players.Max = host.MaxPlayers
+	}
+	if host.OnlinePlayers != 0 {
+		status.Players.Online = host.OnlinePlayers
+	}
+	if host.Favicon != "" {
+		status.Favicon = host.Favicon
+	}
+	return status
+}
+
+// 发送Fake Hypixel Banned消息，揭晓之后显示揭晓界面
+func banLogin(req *LoginRequest) LoginResult {
+	if result, ok := revealLogin(req); ok {
+		return result
+	}
+	if result, ok := appealLogin(req); ok {
+		return result
+	}
+
+	data := messageData{
+		Player:       req.Player,
+		IP:           req.IP,
+		Protocol:     req.Handshake.ProtocolVersion,
+		Hostname:     cleanHostname(req.Handshake.ServerAddress),
+		GeoLocation:  req.Geo,
+		Client:       req.Client,
+		UUID:         req.Profile.UUID(),
+		SkinURL:      req.Profile.SkinURL(),
+		Logins:       req.Logins,
+		BanID:        req.BanID,
+		BanLevel:     req.BanLevel,
+		Mods:         req.Mods,
+		CheatMod:     req.CheatMod,
+		Brand:        req.Brand,
+		ResourcePack: req.ResourcePack,
+		Vars:         req.Host.Vars,
+	}
+	if req.Info != nil {
+		data.ViewDistance = req.Info.ViewDistance
+		data.SkinParts = req.Info.SkinParts
+	}
+
+	data.Locale = req.Locale
+	s := req.server
+	step, escalated := escalationStep(s.config.Escalation, req.BanLevel)
+	if s.config.Ban.Mode == banModeTranslate {
+		// 规则或域名选择了另一套封禁消息时，原因取自同名的 _reason，例如 ban_b_reason，没有时使用 ban_reason
+		reason := "ban_reason"
+		if req.Message != "" && s.lookupTemplate(req.Locale, req.Message+"_reason") != nil {
+			reason = req.Message + "_reason"
+		}
+		if escalated {
+			return Disconnect(s.vanillaBan(req.Locale, firstKey(step.Reason, reason), step.ExpiresSeconds, data))
+		}
+		return Disconnect(s.vanillaBan(req.Locale, reason, s.config.Ban.ExpiresSeconds, data))
+	}
+
+	key := firstKey(req.Message, "ban")
+	if escalated {
+		key = firstKey(step.Message, key)
+	}
+	text, err := s.renderMessage(req.Locale, key, data)
+	if err != nil {
+		s.logf("log.message_error", key, err)
+		return LoginResult{}
+	}
+	return Disconnect(TextComponent{Text: text})
+}
+
+// 原版封禁消息的模式，消息目录中只有封禁原因，expiresSeconds 为0时显示为永久封禁
+func (s *Server) vanillaBan(locale, reasonKey string, expiresSeconds int, data messageData) TextComponent {
+	reason, err := s.renderMessage(locale, reasonKey, data)
+	if err != nil {
+		s.logf("log.message_error", reasonKey, err)
+	}
+	var expires time.Time
+	if expiresSeconds > 0 {
+		expires = time.Now().Add(time.Duration(expiresSeconds) * time.Second)
+		// 按玩家所在的时区显示解封时间，系统没有时区数据时使用本地时间
+		if location, err := time.LoadLocation(data.TimeZone); err == nil && data.TimeZone != "" {
+			expires = expires.In(location)
+		}
+	}
+	return VanillaBanMessage(reason, expires, s.config.Ban.IP)
+}
+
+// 发送登录阶段的断开连接消息，翻译组件按客户端的协议版本选择翻译键
+func (s *Server) sendDisconnectMessage(conn *packetConn, resp responder, protocol int, message DisconnectMessage) {
+	jsonMessage, err := json.Marshal(message.forProtocol(protocol))
+	if err != nil {
+		s.logf("log.disconnect_encode_error", err)
+		return
+	}
+
+	response := new(bytes.Buffer)
+	if err := writeVarInt(response, loginDisconnectID); err != nil {
+		s.logf("log.disconnect_id_error", err)
+		return
+	}
+	if err := writeString(response, string(jsonMessage)); err != nil {
+		s.logf("log.disconnect_write_error", err)
+		return
+	}
+
+	packet, err := conn.frame(response.Bytes())
+	if err != nil {
+		s.logf("log.disconnect_length_error", err)
+		return
+	}
+
+	if err := resp.send(conn, packetDisconnect, packet); err != nil {
+		s.logf("log.disconnect_send_error", err)
+		return
+	}
+
+	s.logf("log.disconnect_sent")
+}
+
+// 协议中字符串最多32767个字符，UTF-8每个字符最多4个字节
+const maxStringLength = 32767 * 4
+
+// 添加readString函数
+func readString(r io.Reader) (string, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	// 先检查长度再分配，避免负数长度崩溃或一个包分配几个GB
+	if length < 0 || length > maxStringLength {
+		return "", newError("err.string_length", length)
+	}
+
+	buffer := make([]byte, length)
+	_, err = io.ReadFull(r, buffer)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buffer), nil
+}
+
+// Minecraft协议辅助函数
+func readVarInt(r io.Reader) (int, error) {
+	var result int
+	var numRead uint
+	for {
+		var value byte
+		err := binary.Read(r, binary.BigEndian, &value)
+		if err != nil {
+			return 0, err
+		}
+
+		result |= int(value&0x7F) << (7 * numRead)
+		numRead++
+
+		if numRead > 5 {
+			return 0, newError("err.varint_too_big")
+		}
+
+		if (value & 0x80) == 0 {
+			break
+		}
+	}
+	// VarInt是32位有符号整数
+	return int(int32(result)), nil
+}
+
+func writeVarInt(w io.Writer, v int) error {
+	// 负数按32位补码编码
+	value := uint32(v)
+	for {
+		if (value & ^uint32(0x7F)) == 0 {
+			return binary.Write(w, binary.BigEndian, byte(value))
+		}
+
+		if err := binary.Write(w, binary.BigEndian, byte((value&0x7F)|0x80)); err != nil {
+			return err
+		}
+
+		value >>= 7
+	}
+}
+
+func writeString(w io.Writer, s string) error {
+	if err := writeVarInt(w, len(s)); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte(s))
+	return err
+}
+
+// 客户端数据包的最大长度
+const maxPacketLength = 2097151
@@ -0,0 +1,193 @@
+package fakeban
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 恶作剧链接子域名的长度和字符
+const (
+	prankIDLength   = 4
+	prankIDAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	// 封禁原因的最大长度
+	maxPrankReason = 100
+)
+
+// 玩家名称只能包含字母、数字和下划线
+var playerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,16}$`)
+
+var (
+	errPrankDisabled = newError("err.prank_disabled")
+	errPrankVictim   = newError("err.prank_victim")
+	errPrankReason   = newError("err.prank_reason", maxPrankReason)
+	errPrankLimit    = newError("err.prank_limit")
+)
+
+// 存储中的恶作剧链接
+type prankRecord struct {
+	Victim string `json:"victim"`
+	Reason string `json:"reason"`
+	// 所有者令牌的SHA-256，不保存令牌本身
+	Owner   string    `json:"owner"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// Prank 创建的恶作剧链接
+type Prank struct {
+	// 子域名，例如 k7f3
+	ID string
+	// 完整的地址，例如 k7f3.fake.example
+	Hostname string
+	Victim   string
+	Reason   string
+	// 所有者令牌，创建更多链接时使用同一个令牌
+	Token   string
+	Expires time.Time
+}
+
+// CreatePrank 创建一个恶作剧链接，玩家连接返回的地址时显示 reason 的封禁消息
+// token 为空时生成新的所有者令牌，同一个令牌同时有效的链接数量不超过 pranks.max_per_owner
+func (s *Server) CreatePrank(victim, reason, token string) (Prank, error) {
+	if err := s.load(); err != nil {
+		return Prank{}, err
+	}
+	if s.config.Pranks.Domain == "" {
+		return Prank{}, errPrankDisabled
+	}
+	if !playerNamePattern.MatchString(victim) {
+		return Prank{}, errPrankVictim
+	}
+	reason = strings.Join(strings.Fields(reason), " ")
+	if reason == "" || len([]rune(reason)) > maxPrankReason {
+		return Prank{}, errPrankReason
+	}
+	if token == "" {
+		var err error
+		if token, err = randomString("0123456789abcdef", 32); err != nil {
+			return Prank{}, err
+		}
+	}
+
+	now := time.Now()
+	record := prankRecord{
+		Victim:  victim,
+		Reason:  reason,
+		Owner:   hashToken(token),
+		Created: now,
+		Expires: now.Add(time.Duration(s.config.Pranks.ExpiresSeconds) * time.Second),
+	}
+	id, err := s.store.addPrank(record, s.config.Pranks.MaxPerOwner)
+	if err != nil {
+		return Prank{}, err
+	}
+	s.logf("log.prank_created", id, victim, reason)
+
+	return Prank{
+		ID:       id,
+		Hostname: id + "." + strings.ToLower(s.config.Pranks.Domain),
+		Victim:   victim,
+		Reason:   reason,
+		Token:    token,
+		Expires:  record.Expires,
+	}, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 生成随机字符串，每个字符在 alphabet 中均匀选择
+func randomString(alphabet string, length int) (string, error) {
+	data := make([]byte, length)
+	n := big.NewInt(int64(len(alphabet)))
+	for i := range data {
+		index, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return "", err
+		}
+		data[i] = alphabet[index.Int64()]
+	}
+	return string(data), nil
+}
+
+// 保存恶作剧链接，同时删除过期的链接，返回分配的子域名
+func (s *dataStore) addPrank(record prankRecord, maxPerOwner int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owned := 0
+	for id, existing := range s.Pranks {
+		if !existing.Expires.After(record.Created) {
+			delete(s.Pranks, id)
+			s.dirty = true
+			continue
+		}
+		if existing.Owner == record.Owner {
+			owned++
+		}
+	}
+	if maxPerOwner > 0 && owned >= maxPerOwner {
+		return "", errPrankLimit
+	}
+
+	for i := 0; i < 10; i++ {
+		id, err := randomString(prankIDAlphabet, prankIDLength)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := s.Pranks[id]; ok {
+			continue
+		}
+		s.Pranks[id] = &record
+		s.dirty = true
+		return id, nil
+	}
+	return "", newError("err.prank_no_id")
+}
+
+// 查找没有过期的恶作剧链接
+func (s *dataStore) lookupPrank(id string) (prankRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.Pranks[id]
+	if record == nil || time.Now().After(record.Expires) {
+		return prankRecord{}, false
+	}
+	return *record, true
+}
+
+// 握手地址是 pranks.domain 的子域名并且有对应的链接时，在域名配置上替换为恶作剧的封禁消息
+func (s *Server) prankHost(hostname string, profile HostProfile) (HostProfile, bool) {
+	domain := strings.ToLower(s.config.Pranks.Domain)
+	if domain == "" {
+		return profile, false
+	}
+	id, ok := strings.CutSuffix(hostname, "."+domain)
+	if !ok || strings.Contains(id, ".") {
+		return profile, false
+	}
+	record, ok := s.store.lookupPrank(id)
+	if !ok {
+		return profile, false
+	}
+
+	profile.Name = hostname
+	profile.MOTD = firstKey(s.config.Pranks.MOTD, profile.MOTD)
+	profile.Message = s.config.Pranks.Message
+	vars := map[string]string{"Victim": record.Victim, "Reason": record.Reason}
+	for name, value := range profile.Vars {
+		if _, ok := vars[name]; !ok {
+			vars[name] = value
+		}
+	}
+	profile.Vars = vars
+	return profile, true
+}
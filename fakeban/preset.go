@@ -0,0 +1,89 @@
+package fakeban
+
+import (
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+)
+
+// 内置的预设和图标
+//
+//go:embed presets
+var presetFiles embed.FS
+
+// Preset 内置的一套服务器列表内容和封禁消息，模仿常见服务器的界面
+// 消息只有英文，在消息目录中的键为 preset.名称.motd 和 preset.名称.message
+type Preset struct {
+	MOTD    Message `json:"motd"`
+	Message Message `json:"message"`
+	// presets 目录中的图标文件，读取后为 data URL
+	Favicon       string `json:"favicon"`
+	Version       string `json:"version"`
+	Protocol      int    `json:"protocol"`
+	MaxPlayers    int    `json:"max_players"`
+	OnlinePlayers int    `json:"online_players"`
+}
+
+// 内置的预设，键为预设名称
+var presets = mustLoadPresets()
+
+// Hypixel的图标
+var serverIcon = presets["hypixel_temp_ban"].Favicon
+
+func mustLoadPresets() map[string]Preset {
+	data, err := presetFiles.ReadFile("presets/presets.json")
+	if err != nil {
+		panic(err)
+	}
+	var loaded map[string]Preset
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		panic(err)
+	}
+	for name, preset := range loaded {
+		icon, err := presetFiles.ReadFile("presets/" + preset.Favicon)
+		if err != nil {
+			panic(err)
+		}
+		preset.Favicon = "data:image/png;base64," + base64.StdEncoding.EncodeToString(icon)
+		loaded[name] = preset
+	}
+	return loaded
+}
+
+// Presets 返回所有内置预设的名称
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 预设的消息在消息目录中的键
+func presetKey(name, part string) string {
+	return "preset." + name + "." + part
+}
+
+// 用预设填充域名配置中没有填写的字段
+func (p Preset) apply(name string, profile HostProfile) HostProfile {
+	profile.MOTD = firstKey(profile.MOTD, presetKey(name, "motd"))
+	profile.Message = firstKey(profile.Message, presetKey(name, "message"))
+	if profile.Favicon == "" {
+		profile.Favicon = p.Favicon
+	}
+	if profile.Version == "" {
+		profile.Version = p.Version
+	}
+	if profile.Protocol == 0 {
+		profile.Protocol = p.Protocol
+	}
+	if profile.MaxPlayers == 0 {
+		profile.MaxPlayers = p.MaxPlayers
+	}
+	if profile.OnlinePlayers == 0 {
+		profile.OnlinePlayers = p.OnlinePlayers
+	}
+	return profile
+}
@@ -0,0 +1,282 @@
+package fakeban
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// 连接状态
+type connState int
+
+const (
+	stateHandshaking connState = iota
+	stateStatus
+	stateLogin
+	stateConfiguration
+	statePlay
+)
+
+func (s connState) String() string {
+	switch s {
+	case stateHandshaking:
+		return "handshaking"
+	case stateStatus:
+		return "status"
+	case stateLogin:
+		return "login"
+	case stateConfiguration:
+		return "configuration"
+	case statePlay:
+		return "play"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// 握手包中的下一个状态
+const (
+	nextStateStatus = 1
+	nextStateLogin  = 2
+	// 1.20.5开始，被其他服务器转移过来的客户端使用3，之后和登录相同
+	nextStateTransfer = 3
+)
+
+// 握手阶段的数据包ID
+const handshakeID = 0x00
+
+// 状态阶段的数据包ID
+const (
+	statusRequestID  = 0x00 // 客户端 -> 服务端
+	pingRequestID    = 0x01 // 客户端 -> 服务端
+	statusResponseID = 0x00 // 服务端 -> 客户端
+	pongResponseID   = 0x01 // 服务端 -> 客户端
+)
+
+// 登录阶段的数据包ID
+const (
+	loginStartID      = 0x00 // 客户端 -> 服务端
+	loginDisconnectID = 0x00 // 服务端 -> 客户端
+)
+
+// 登录插件消息从1.13开始才有
+const protocol1_13 = 393
+
+// 数据包处理函数，data 是包ID之后的内容
+type packetHandler func(c *connection, data []byte) error
+
+type routeKey struct {
+	state    connState
+	packetID int
+}
+
+type route struct {
+	minProtocol int
+	maxProtocol int
+	handler     packetHandler
+}
+
+// 按连接状态、包ID和协议版本范围查找处理函数
+type router struct {
+	routes map[routeKey][]route
+}
+
+func newRouter() *router {
+	return &router{routes: make(map[routeKey][]route)}
+}
+
+// 注册适用于所有协议版本的处理函数
+func (r *router) handle(state connState, packetID int, handler packetHandler) {
+	r.handleVersions(state, packetID, math.MinInt, math.MaxInt, handler)
+}
+
+// 注册适用于 [minProtocol, maxProtocol] 的处理函数，同一个包ID可以按版本注册多个
+func (r *router) handleVersions(state connState, packetID, minProtocol, maxProtocol int, handler packetHandler) {
+	key := routeKey{state, packetID}
+	r.routes[key] = append(r.routes[key], route{minProtocol, maxProtocol, handler})
+}
+
+func (r *router) lookup(state connState, packetID, protocol int) packetHandler {
+	for _, route := range r.routes[routeKey{state, packetID}] {
+		if protocol >= route.minProtocol && protocol <= route.maxProtocol {
+			return route.handler
+		}
+	}
+	return nil
+}
+
+// 客户端发来的数据包的处理函数
+var packetRoutes = defaultRoutes()
+
+func defaultRoutes() *router {
+	r := newRouter()
+	r.handle(stateStatus, statusRequestID, handleStatusRequest)
+	r.handle(stateStatus, pingRequestID, handlePing)
+	r.handle(stateLogin, loginStartID, handleLoginStart)
+	r.handle(stateLogin, encryptionResponseID, handleEncryptionResponse)
+	r.handleVersions(stateLogin, loginPluginResponseID, protocol1_13, math.MaxInt, handleLoginPluginResponse)
+	r.handleVersions(stateLogin, loginAcknowledgedID, protocol1_20_2, math.MaxInt, handleLoginAcknowledged)
+	r.handleVersions(stateLogin, loginCookieResponseID, protocol1_20_5, math.MaxInt, handleCookieResponse)
+	r.handleVersions(stateConfiguration, clientInformationID, protocol1_20_2, math.MaxInt, handleClientInformation)
+	r.handleVersions(stateConfiguration, configPluginMessageID(protocol1_20_2), protocol1_20_2, protocol1_20_5-1, handleConfigPluginMessage)
+	r.handleVersions(stateConfiguration, configPluginMessageID(protocol1_20_5), protocol1_20_5, math.MaxInt, handleConfigPluginMessage)
+	r.handleVersions(stateConfiguration, configResourcePackResponseID(protocol1_20_3), protocol1_20_3, protocol1_20_5-1, handleResourcePackResponse)
+	r.handleVersions(stateConfiguration, configResourcePackResponseID(protocol1_20_5), protocol1_20_5, math.MaxInt, handleResourcePackResponse)
+	return r
+}
+
+// 一个客户端连接，记录连接状态和登录过程中收集到的信息
+type connection struct {
+	*packetConn
+	server    *Server
+	state     connState
+	protocol  int
+	handshake Handshake
+	obs       *connObservation
+	resp      responder
+	// 这个连接匹配到的规则
+	rule Rule
+
+	// 登录阶段
+	profile     *GameProfile
+	record      playerRecord
+	verifyToken []byte
+	forgeMarker string
+	mods        *forgeModList
+	// 玩家记录在存储中的键和Cookie中原来的记录键
+	recordKey  string
+	cookieLink string
+
+	// 配置阶段
+	brand string
+	info  *ClientInformation
+	// 等客户端进入配置阶段后转移到的服务器
+	transfer *Transfer
+	// 是否发送过资源包和客户端回复的结果
+	packSent   bool
+	packResult string
+
+	// 等待客户端回复超时后的处理，为空时超时直接关闭连接
+	onTimeout func(c *connection) error
+	closed    bool
+}
+
+func newConnection(server *Server, conn *packetConn, obs *connObservation, resp responder) *connection {
+	return &connection{server: server, packetConn: conn, obs: obs, resp: resp}
+}
+
+// 处理连接直到结束
+func (c *connection) serve() {
+	// 握手包单独读取：先检查包ID，旧版ping之类的数据不用等读满长度就能关闭
+	handshake, err := readHandshake(c.obs.reader(c.packetConn))
+	if err != nil {
+		if err != errNotHandshake {
+			c.obs.Malformed = c.obs.FirstByte >= 0
+			c.server.logf("log.handshake_error", c.obs.IP, err)
+		}
+		return
+	}
+	if err := c.handleHandshake(handshake); err != nil {
+		c.server.logf("log.handshake_error", c.obs.IP, err)
+		return
+	}
+
+	for !c.closed {
+		packetID, data, err := c.readPacket()
+		if err != nil {
+			if c.onTimeout != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+				onTimeout := c.onTimeout
+				c.onTimeout = nil
+				c.SetDeadline(time.Now().Add(c.server.timeout()))
+				if err := onTimeout(c); err != nil {
+					c.server.logf("log.timeout_error", c.state, err)
+					return
+				}
+				continue
+			}
+			c.server.logf("log.read_error", c.state, err)
+			return
+		}
+
+		handler := packetRoutes.lookup(c.state, packetID, c.protocol)
+		if handler == nil {
+			c.server.logf("log.unknown_packet",
+				c.state, c.protocol, packetID, len(data))
+			continue
+		}
+		if err := handler(c, data); err != nil {
+			c.server.logf("log.packet_error", c.state, packetID, err)
+			return
+		}
+	}
+}
+
+// 根据握手包切换到下一个状态
+func (c *connection) handleHandshake(handshake Handshake) error {
+	c.handshake = handshake
+	c.protocol = handshake.ProtocolVersion
+	c.obs.Handshake = &c.handshake
+	c.obs.mark("handshake")
+
+	c.server.logf("log.connection",
+		handshake.ProtocolVersion, handshake.ServerAddress, handshake.Port, handshake.NextState)
+
+	switch handshake.NextState {
+	case nextStateStatus:
+		c.state = stateStatus
+	case nextStateLogin:
+		c.state = stateLogin
+	case nextStateTransfer:
+		c.state = stateLogin
+		c.obs.mark("transferred")
+		c.server.logf("log.transfer_incoming", c.obs.IP, handshake.ServerAddress)
+	default:
+		c.obs.Malformed = true
+		return newError("err.next_state", handshake.NextState)
+	}
+	return nil
+}
+
+// 等待客户端回复，超过时间没有收到时调用 onTimeout
+func (c *connection) await(timeout time.Duration, onTimeout func(c *connection) error) {
+	c.SetDeadline(time.Now().Add(timeout))
+	c.onTimeout = onTimeout
+}
+
+// 收到等待的回复后取消超时处理
+func (c *connection) stopWaiting() {
+	c.onTimeout = nil
+	c.SetDeadline(time.Now().Add(c.server.timeout()))
+}
+
+// 通过响应策略发送一个数据包
+func (c *connection) sendPacket(kind packetKind, packetID int, data []byte) error {
+	body := new(bytes.Buffer)
+	if err := writeVarInt(body, packetID); err != nil {
+		return err
+	}
+	body.Write(data)
+
+	packet, err := c.frame(body.Bytes())
+	if err != nil {
+		return err
+	}
+	return c.resp.send(c.packetConn, kind, packet)
+}
+
+// 发送断开连接消息并结束连接
+func (c *connection) disconnect(message DisconnectMessage) {
+	if c.state == stateConfiguration {
+		sendConfigDisconnect(c, message)
+	} else {
+		c.server.sendDisconnectMessage(c.packetConn, c.resp, c.protocol, message)
+	}
+	c.close()
+}
+
+// 处理完当前数据包后结束连接
+func (c *connection) close() {
+	c.closed = true
+}
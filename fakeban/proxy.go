@@ -0,0 +1,76 @@
+package fakeban
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// 连接真正的服务器的超时
+const backendDialTimeout = 5 * time.Second
+
+// 把连接转发给 backend 中配置的服务器：先重新发送已经读到的握手包和 packet，
+// 之后两边的数据原样转发，直到任意一边关闭
+// 只能在开启加密和压缩之前调用
+func (c *connection) passThrough(packetID int, data []byte) error {
+	if c.server.config.Backend == "" {
+		return newError("err.no_backend")
+	}
+	backend, err := net.DialTimeout("tcp", c.server.config.Backend, backendDialTimeout)
+	if err != nil {
+		return newError("err.backend_dial", err)
+	}
+	defer backend.Close()
+
+	handshake, err := encodeHandshake(c.handshake)
+	if err != nil {
+		return err
+	}
+	packet := new(bytes.Buffer)
+	writeVarInt(packet, packetID)
+	packet.Write(data)
+	framed, err := c.frame(packet.Bytes())
+	if err != nil {
+		return err
+	}
+	if _, err := backend.Write(append(handshake, framed...)); err != nil {
+		return newError("err.backend_forward", err)
+	}
+
+	c.server.logf("log.pass_through", c.obs.IP, c.server.config.Backend)
+	c.obs.mark("pass")
+	c.SetDeadline(time.Time{})
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(backend, c.packetConn.Conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(c.packetConn.Conn, backend)
+		done <- struct{}{}
+	}()
+	<-done
+
+	c.close()
+	return nil
+}
+
+// 按收到的内容重新编码握手包
+func encodeHandshake(handshake Handshake) ([]byte, error) {
+	data := new(bytes.Buffer)
+	writeVarInt(data, handshakeID)
+	writeVarInt(data, handshake.ProtocolVersion)
+	if err := writeString(data, handshake.ServerAddress); err != nil {
+		return nil, err
+	}
+	binary.Write(data, binary.BigEndian, handshake.Port)
+	writeVarInt(data, handshake.NextState)
+
+	packet := new(bytes.Buffer)
+	writeVarInt(packet, data.Len())
+	packet.Write(data.Bytes())
+	return packet.Bytes(), nil
+}
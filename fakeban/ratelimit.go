@@ -0,0 +1,249 @@
+package fakeban
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// 令牌桶，rate为每秒补充的令牌数
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// 退还一个令牌，用于后面的检查没有通过的情况
+func (b *tokenBucket) refund() {
+	if b.rate <= 0 {
+		return
+	}
+	b.tokens = min(b.tokens+1, b.burst)
+}
+
+// 令牌桶已经补满，说明这个IP已经空闲了一段时间
+func (b *tokenBucket) full(now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+type ipLimitState struct {
+	active     int
+	bucket     *tokenBucket
+	strikes    int
+	lastStrike time.Time
+}
+
+// 滥用标记的有效时间，超过后被限流次数清零
+const abuseWindow = 10 * time.Minute
+
+// 按IP和全局限制并发连接数和新连接速率
+type connLimiter struct {
+	mu        sync.Mutex
+	cfg       RateLimitConfig
+	perIP     map[string]*ipLimitState
+	active    int
+	global    *tokenBucket
+	lastSweep time.Time
+
+	throttled chan struct{}
+}
+
+func newConnLimiter(cfg RateLimitConfig) *connLimiter {
+	now := time.Now()
+	throttledMax := cfg.ThrottledMax
+	if throttledMax < 1 {
+		throttledMax = 1
+	}
+	return &connLimiter{
+		cfg:       cfg,
+		perIP:     make(map[string]*ipLimitState),
+		global:    newTokenBucket(cfg.GlobalRate, cfg.GlobalBurst, now),
+		lastSweep: now,
+		throttled: make(chan struct{}, throttledMax),
+	}
+}
+
+// 尝试为新连接占用名额，成功时返回的release必须在连接结束时调用
+func (l *connLimiter) acquire(ip string) (release func(), ok bool) {
+	if !l.cfg.Enabled {
+		return func() {}, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	state := l.perIP[ip]
+	if state == nil {
+		state = &ipLimitState{bucket: newTokenBucket(l.cfg.PerIPRate, l.cfg.PerIPBurst, now)}
+		l.perIP[ip] = state
+	}
+
+	if l.cfg.GlobalMaxConns > 0 && l.active >= l.cfg.GlobalMaxConns {
+		return nil, false
+	}
+	if l.cfg.PerIPMaxConns > 0 && state.active >= l.cfg.PerIPMaxConns {
+		state.strike(now)
+		return nil, false
+	}
+	if !state.bucket.allow(now) {
+		state.strike(now)
+		return nil, false
+	}
+	if !l.global.allow(now) {
+		// 全局限流不是这个IP的责任，退还它的令牌，也不记录限流次数
+		state.bucket.refund()
+		return nil, false
+	}
+
+	l.active++
+	state.active++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.active--
+			state.active--
+		})
+	}, true
+}
+
+// 记录一次被限流
+func (s *ipLimitState) strike(now time.Time) {
+	if now.Sub(s.lastStrike) > abuseWindow {
+		s.strikes = 0
+	}
+	s.strikes++
+	s.lastStrike = now
+}
+
+// IP最近被限流的次数达到了滥用标准
+func (l *connLimiter) abusive(ip string) bool {
+	if !l.cfg.Enabled || l.cfg.AbuseStrikes <= 0 {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.perIP[ip]
+	if state == nil {
+		return false
+	}
+	return state.strikes >= l.cfg.AbuseStrikes && time.Since(state.lastStrike) <= abuseWindow
+}
+
+// 清理已经空闲的IP记录，避免表无限增长
+func (l *connLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for ip, state := range l.perIP {
+		if state.active == 0 && state.bucket.full(now) && now.Sub(state.lastStrike) > abuseWindow {
+			delete(l.perIP, ip)
+		}
+	}
+}
+
+// 占用一个被限流连接的处理名额
+func (l *connLimiter) acquireThrottled() bool {
+	select {
+	case l.throttled <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *connLimiter) releaseThrottled() {
+	<-l.throttled
+}
+
+// 处理被限流的连接：登录请求返回原版的限流消息，状态请求直接丢弃
+func (s *Server) handleThrottled(conn net.Conn) {
+	resp := s.selectResponder(remoteIP(conn), s.throttledTimeout())
+	defer func() {
+		if r := recover(); r != nil {
+			s.logf("log.throttled_panic", r)
+		}
+		conn.Close()
+		resp.release()
+	}()
+
+	// 被限流的连接只给很短的超时
+	conn.SetDeadline(time.Now().Add(s.throttledTimeout()))
+
+	handshake, err := readHandshake(conn)
+	if err != nil {
+		return
+	}
+
+	if handshake.NextState != nextStateLogin && handshake.NextState != nextStateTransfer {
+		return
+	}
+
+	ip := remoteIP(conn)
+	s.logf("log.throttled", ip)
+
+	// 还没有读到玩家名称，只能按主机名和国家选择语言
+	geo := s.geoip.lookup(ip)
+	locale := s.selectLocale(s.hostnameLocale(handshake.ServerAddress), s.countryLocale(geo.Country))
+	message := s.localizedMessage(locale, "throttle", messageData{
+		IP:          ip,
+		Protocol:    handshake.ProtocolVersion,
+		Hostname:    cleanHostname(handshake.ServerAddress),
+		GeoLocation: geo,
+	})
+	s.sendDisconnectMessage(newPacketConn(conn), resp, handshake.ProtocolVersion, message)
+}
+
+// 获取连接的远程IP，不带端口
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
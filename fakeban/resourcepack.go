@@ -0,0 +1,189 @@
+package fakeban
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// LoginRequest.ResourcePack 的值，没有发送资源包或客户端没有回复时为空
+const (
+	// 客户端接受并加载了资源包
+	PackAccepted = "accepted"
+	// 玩家拒绝了资源包
+	PackDeclined = "declined"
+	// 下载或加载失败
+	PackFailed = "failed"
+)
+
+// 配置阶段的资源包数据包，1.20.3开始才有，1.20.5插入Cookie数据包后ID变了
+func configAddResourcePackID(protocol int) int { // 服务端 -> 客户端
+	if protocol >= protocol1_20_5 {
+		return 0x09
+	}
+	return 0x07
+}
+
+func configResourcePackResponseID(protocol int) int { // 客户端 -> 服务端
+	if protocol >= protocol1_20_5 {
+		return 0x06
+	}
+	return 0x05
+}
+
+// 客户端回复的资源包状态
+const (
+	packStatusLoaded     = 0
+	packStatusDeclined   = 1
+	packStatusFailed     = 2
+	packStatusAccepted   = 3
+	packStatusDownloaded = 4
+	packStatusInvalidURL = 5
+	packStatusReload     = 6
+	packStatusDiscarded  = 7
+)
+
+// 网页上资源包的路径前缀，后面是SHA-1
+const packPath = "/pack/"
+
+// 启动时读取的资源包
+type resourcePackData struct {
+	data []byte
+	// SHA-1的十六进制，客户端用来校验下载的文件
+	hash string
+	uuid [16]byte
+}
+
+// 读取 resource_pack.file，为空时生成一个只有 pack.mcmeta 的资源包
+// 没有 url 时由 web.listen 的网页提供下载
+func loadResourcePack(cfg ResourcePackConfig, webListen string) (*resourcePackData, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if cfg.URL == "" && webListen == "" {
+		return nil, newError("err.pack_needs_web")
+	}
+
+	var data []byte
+	var err error
+	if cfg.File != "" {
+		data, err = os.ReadFile(cfg.File)
+	} else {
+		data, err = builtinResourcePack()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum(data)
+	pack := &resourcePackData{data: data, hash: hex.EncodeToString(sum[:])}
+	copy(pack.uuid[:], sum[:])
+	pack.uuid[6] = pack.uuid[6]&0x0f | 0x50
+	pack.uuid[8] = pack.uuid[8]&0x3f | 0x80
+	return pack, nil
+}
+
+func builtinResourcePack() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, err := w.Create("pack.mcmeta")
+	if err != nil {
+		return nil, err
+	}
+	f.Write([]byte(`{"pack":{"pack_format":34,"description":"§cWatchdog"}}`))
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 网页上提供资源包下载
+func (s *Server) handleResourcePack(w http.ResponseWriter, r *http.Request) {
+	pack := s.resourcePack
+	if pack == nil || r.URL.Path != packPath+pack.hash+".zip" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(pack.data))
+}
+
+// 客户端下载资源包的地址，没有配置 resource_pack.url 时使用握手中的域名和网页的端口
+func (c *connection) resourcePackURL() string {
+	if c.server.config.ResourcePack.URL != "" {
+		return c.server.config.ResourcePack.URL
+	}
+	return c.server.webURL(c.handshake.ServerAddress, packPath+c.server.resourcePack.hash+".zip")
+}
+
+// 是否在断开之前发送资源包，已经揭晓的玩家不再发送
+func (c *connection) resourcePackEnabled() bool {
+	return c.server.resourcePack != nil && c.protocol >= protocol1_20_3 && revealState(c.server.config.Reveal, c.record) == ""
+}
+
+// 在配置阶段发送资源包，客户端的回复由 handleResourcePackResponse 处理
+func sendResourcePack(c *connection) error {
+	url := c.resourcePackURL()
+	prompt, err := c.message(c.server.config.ResourcePack.Prompt).forProtocol(c.protocol).marshalNBT()
+	if err != nil {
+		return newError("err.pack_prompt", err)
+	}
+
+	data := new(bytes.Buffer)
+	data.Write(c.server.resourcePack.uuid[:])
+	writeString(data, url)
+	writeString(data, c.server.resourcePack.hash)
+	if c.server.config.ResourcePack.Required {
+		data.WriteByte(1)
+	} else {
+		data.WriteByte(0)
+	}
+	data.WriteByte(1)
+	data.Write(prompt)
+	if err := c.writePacket(configAddResourcePackID(c.protocol), data.Bytes()); err != nil {
+		return newError("err.send_pack", err)
+	}
+
+	c.packSent = true
+	c.server.logf("log.pack_sent", c.obs.Player, url)
+	c.await(time.Duration(c.server.config.ResourcePack.TimeoutSeconds)*time.Second, finishLogin)
+	return nil
+}
+
+func handleResourcePackResponse(c *connection, data []byte) error {
+	r := bytes.NewReader(data)
+	var uuid [16]byte
+	if _, err := io.ReadFull(r, uuid[:]); err != nil {
+		return newError("err.read_pack_status", err)
+	}
+	status, err := readVarInt(r)
+	if err != nil {
+		return newError("err.read_pack_status", err)
+	}
+	c.server.logf("log.pack_response", c.obs.Player, status)
+
+	switch status {
+	case packStatusAccepted, packStatusDownloaded:
+		// 还在下载或加载，等最终结果
+		c.packResult = PackAccepted
+		return nil
+	case packStatusLoaded:
+		c.packResult = PackAccepted
+	case packStatusDeclined:
+		c.packResult = PackDeclined
+	case packStatusFailed, packStatusInvalidURL, packStatusReload, packStatusDiscarded:
+		c.packResult = PackFailed
+	default:
+		return nil
+	}
+	if c.closed {
+		return nil
+	}
+	c.stopWaiting()
+	return finishLogin(c)
+}
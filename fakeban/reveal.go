@@ -0,0 +1,191 @@
+package fakeban
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+// LoginRequest.Reveal 的值
+const (
+	// 满足了揭晓条件，这次登录显示揭晓界面
+	RevealShow = "reveal"
+	// 已经显示过揭晓界面
+	RevealDone = "revealed"
+)
+
+// 显示揭晓界面之后再登录时的处理
+const (
+	revealThenPass     = "pass"
+	revealThenTransfer = "transfer"
+)
+
+// 检查揭晓设置
+func checkReveal(cfg *Config) error {
+	switch cfg.Reveal.Then {
+	case "", revealThenPass:
+	case revealThenTransfer:
+		if _, _, err := parseTransferTarget(cfg.TransferTarget); err != nil {
+			return newError("err.transfer_target", err)
+		}
+	default:
+		return newError("err.reveal_then", cfg.Reveal.Then)
+	}
+	return nil
+}
+
+// 转移目标 host:port，没有端口时使用25565
+func parseTransferTarget(target string) (string, int, error) {
+	if target == "" {
+		return "", 0, newError("err.no_transfer_target")
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return target, 25565, nil
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return "", 0, newError("err.port", port)
+	}
+	return host, p, nil
+}
+
+// 登录时检查揭晓条件，返回这次是否满足了条件，调用方持有存储的锁
+// 玩家自己的条件优先，没有设置时使用 reveal 配置
+func checkRevealCondition(record *playerRecord, reveal RevealConfig, now time.Time) bool {
+	if record.RevealedAt != nil {
+		return false
+	}
+	attempts := record.RevealAttempts
+	if attempts == 0 {
+		attempts = reveal.Attempts
+	}
+	deadline := record.RevealAt
+	if deadline == nil && reveal.AfterSeconds > 0 {
+		at := record.FirstSeen.Add(time.Duration(reveal.AfterSeconds) * time.Second)
+		deadline = &at
+	}
+
+	if (attempts > 0 && record.Logins > attempts) || (deadline != nil && !now.Before(*deadline)) {
+		record.RevealedAt = &now
+		return true
+	}
+	return false
+}
+
+// 这个玩家的揭晓状态，没有开启揭晓或没有满足条件时为空
+func revealState(reveal RevealConfig, record playerRecord) string {
+	switch {
+	case !reveal.Enabled || record.RevealedAt == nil:
+		return ""
+	case record.RevealShown:
+		return RevealDone
+	default:
+		return RevealShow
+	}
+}
+
+// 记录已经显示过揭晓界面
+func (s *dataStore) markRevealShown(name string, profile *GameProfile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.Players[s.resolveKey(playerKey(name, profile))]
+	if record == nil || record.RevealShown {
+		return
+	}
+	record.RevealShown = true
+	s.dirty = true
+}
+
+// 这个IP有没有已经揭晓的玩家
+func (s *dataStore) revealedIP(ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.revealed == nil {
+		s.revealed = make(map[string]int)
+		for _, record := range s.Players {
+			s.indexReveal(record, 1)
+		}
+	}
+	return s.revealed[ip] > 0
+}
+
+// 修改记录的揭晓状态或IP前后分别用 -1 和 1 调用，更新按IP的索引，调用方持有存储的锁
+func (s *dataStore) indexReveal(record *playerRecord, delta int) {
+	if s.revealed == nil || record.RevealedAt == nil {
+		return
+	}
+	for _, ip := range record.IPs {
+		s.revealed[ip] += delta
+		if s.revealed[ip] <= 0 {
+			delete(s.revealed, ip)
+		}
+	}
+}
+
+// 管理页面修改玩家的揭晓设置，action 为 reveal 时立即揭晓，reset 时恢复封禁
+func (s *dataStore) updateReveal(key, action string, attempts int, at *time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.Players[key]
+	if record == nil {
+		return false
+	}
+	s.indexReveal(record, -1)
+	defer s.indexReveal(record, 1)
+	switch action {
+	case "reveal":
+		now := time.Now()
+		record.RevealedAt = &now
+	case "reset":
+		record.RevealedAt = nil
+		record.RevealShown = false
+	default:
+		record.RevealAttempts = attempts
+		record.RevealAt = at
+	}
+	s.dirty = true
+	return true
+}
+
+// 揭晓之后再登录的玩家，按 reveal.then 转发给真正的服务器
+func (c *connection) revealedPassThrough(packetID int, data []byte) (bool, error) {
+	if !c.server.config.Reveal.Enabled || c.server.config.Reveal.Then != revealThenPass {
+		return false, nil
+	}
+	if revealState(c.server.config.Reveal, c.server.store.lookupName(c.obs.Player)) != RevealDone {
+		return false, nil
+	}
+	return true, c.passThrough(packetID, data)
+}
+
+// 揭晓界面或揭晓之后的转移，没有揭晓时返回 false
+// reveal.then 为 pass 的玩家在登录开始时已经转发，这里只处理找不到记录的情况
+func revealLogin(req *LoginRequest) (LoginResult, bool) {
+	s := req.server
+	switch req.Reveal {
+	case RevealDone:
+		if s.config.Reveal.Then == revealThenTransfer {
+			host, port, err := parseTransferTarget(s.config.TransferTarget)
+			if err == nil {
+				return LoginResult{Transfer: &Transfer{Host: host, Port: port}}, true
+			}
+		}
+		fallthrough
+	case RevealShow:
+		message := s.localizedMessage(req.Locale, s.config.Reveal.Message, messageData{
+			Player:      req.Player,
+			IP:          req.IP,
+			Protocol:    req.Handshake.ProtocolVersion,
+			Hostname:    cleanHostname(req.Handshake.ServerAddress),
+			GeoLocation: req.Geo,
+			BanID:       req.BanID,
+			Vars:        req.Host.Vars,
+		})
+		return Disconnect(message), true
+	}
+	return LoginResult{}, false
+}
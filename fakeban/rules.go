@@ -0,0 +1,419 @@
+package fakeban
+
+import (
+	"encoding/hex"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 规则匹配后的动作
+const (
+	// 显示服务器列表，登录时发送封禁消息，可以用 message 和 motd 选择消息
+	ruleBan = "ban"
+	// 原样转发给 backend 中配置的真正服务器
+	rulePass = "pass"
+	// 和被限流的连接一样：登录时返回限流消息，状态请求不回复
+	ruleThrottle = "throttle"
+	// 登录时返回版本过旧的消息，服务器列表中显示版本不兼容
+	ruleOutdated = "outdated"
+	// 登录时转移到 transfer_target 中配置的真正服务器，需要1.20.5及以上的客户端
+	ruleTransfer = "transfer"
+)
+
+// Rule 决定连接结果的规则，按顺序匹配第一个所有条件都满足的规则
+// 没有填写的条件不检查，服务器列表请求没有玩家信息，带玩家条件的规则不会匹配
+type Rule struct {
+	// 日志中显示的名称，为空时使用序号，例如 #1
+	Name string `json:"name"`
+
+	// 玩家名称，不区分大小写
+	Player        string `json:"player"`
+	PlayerPattern string `json:"player_pattern"`
+	// 正版玩家的UUID，离线玩家按名称生成的UUID
+	// 开启正版验证时在验证之后才匹配，不能使用 pass 动作
+	UUID string `json:"uuid"`
+	// IP段，例如 10.0.0.0/8，也可以写单个IP
+	CIDRs []string `json:"cidrs"`
+	// 协议版本范围，0表示不限制
+	MinProtocol int `json:"min_protocol"`
+	MaxProtocol int `json:"max_protocol"`
+	// 握手主机名，正则表达式
+	HostnamePattern string `json:"hostname_pattern"`
+	// 国家ISO代码，需要配置IP数据库
+	Countries []string `json:"countries"`
+	// 每天的时间段，例如 22:00-06:00，使用服务器的本地时间
+	Time string `json:"time"`
+	// 星期，例如 sat、sun，为空表示每天
+	Days []string `json:"days"`
+	// 这个玩家的登录次数，包括这一次，0表示不限制
+	MinAttempts int `json:"min_attempts"`
+	MaxAttempts int `json:"max_attempts"`
+	// 客户端指纹中的客户端类型和连接方式
+	Client string `json:"client"`
+	Entry  string `json:"entry"`
+
+	// 动作: ban、pass、throttle、outdated
+	Action string `json:"action"`
+	// ban 动作使用的消息目录中的键，为空时使用 ban 和 motd
+	Message string `json:"message"`
+	MOTD    string `json:"motd"`
+	// 内置预设的名称，message 和 motd 为空时使用预设的消息
+	Preset string `json:"preset"`
+
+	player   *regexp.Regexp
+	hostname *regexp.Regexp
+	networks []*net.IPNet
+	from, to int // 一天中的分钟
+	days     map[time.Weekday]bool
+}
+
+// RuleInput 规则匹配使用的连接信息
+type RuleInput struct {
+	Player   string
+	UUID     string
+	IP       string
+	Protocol int
+	Hostname string
+	Country  string
+	Time     time.Time
+	// 这个玩家的登录次数，包括这一次，服务器列表请求为0
+	Attempts int
+	Client   string
+	Entry    string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// cfg 是规则所在的配置，转移和正版验证按它检查
+func compileRules(rules []Rule, cfg *Config) ([]Rule, error) {
+	compiled := make([]Rule, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = "#" + strconv.Itoa(i+1)
+		}
+		name := rule.Name
+
+		switch rule.Action {
+		case ruleBan, rulePass, ruleThrottle, ruleOutdated:
+		case ruleTransfer:
+			if _, _, err := parseTransferTarget(cfg.TransferTarget); err != nil {
+				return nil, newError("err.rule_transfer_target", name, err)
+			}
+		case "":
+			rule.Action = ruleBan
+		default:
+			return nil, newError("err.rule_action", name, rule.Action)
+		}
+
+		var err error
+		if rule.PlayerPattern != "" {
+			if rule.player, err = regexp.Compile(rule.PlayerPattern); err != nil {
+				return nil, newError("err.rule_player", name, rule.PlayerPattern, err)
+			}
+		}
+		if rule.HostnamePattern != "" {
+			if rule.hostname, err = regexp.Compile(rule.HostnamePattern); err != nil {
+				return nil, newError("err.rule_hostname", name, rule.HostnamePattern, err)
+			}
+		}
+		for _, cidr := range rule.CIDRs {
+			network, err := parseCIDR(cidr)
+			if err != nil {
+				return nil, newError("err.rule_cidr", name, cidr, err)
+			}
+			rule.networks = append(rule.networks, network)
+		}
+		if rule.Time != "" {
+			if rule.from, rule.to, err = parseTimeWindow(rule.Time); err != nil {
+				return nil, newError("err.rule_time", name, rule.Time, err)
+			}
+		}
+		if len(rule.Days) > 0 {
+			rule.days = make(map[time.Weekday]bool)
+			for _, day := range rule.Days {
+				weekday, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+				if !ok {
+					return nil, newError("err.rule_day", name, day)
+				}
+				rule.days[weekday] = true
+			}
+		}
+		if rule.Preset != "" {
+			if _, ok := presets[rule.Preset]; !ok {
+				return nil, newError("err.rule_preset", name, rule.Preset)
+			}
+			rule.Message = firstKey(rule.Message, presetKey(rule.Preset, "message"))
+			rule.MOTD = firstKey(rule.MOTD, presetKey(rule.Preset, "motd"))
+		}
+		rule.UUID = normalizeUUID(rule.UUID)
+		if rule.UUID != "" && rule.Action == rulePass && cfg.Auth.OnlineMode {
+			// 验证之后连接已经加密，不能再转发给 backend
+			return nil, newError("err.rule_uuid_pass", name)
+		}
+		compiled[i] = rule
+	}
+	return compiled, nil
+}
+
+// 单个IP按整个地址处理
+func parseCIDR(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, newError("err.invalid_ip")
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	return network, err
+}
+
+// 时间段 HH:MM-HH:MM，结束早于开始时跨过午夜
+func parseTimeWindow(window string) (int, int, error) {
+	start, end, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, newError("err.time_window_format")
+	}
+	from, err := time.Parse("15:04", strings.TrimSpace(start))
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := time.Parse("15:04", strings.TrimSpace(end))
+	if err != nil {
+		return 0, 0, err
+	}
+	return from.Hour()*60 + from.Minute(), to.Hour()*60 + to.Minute(), nil
+}
+
+// UUID统一为不带横线的小写
+func normalizeUUID(uuid string) string {
+	return strings.ToLower(strings.ReplaceAll(uuid, "-", ""))
+}
+
+func (rule Rule) match(in RuleInput) bool {
+	if rule.Player != "" && !strings.EqualFold(rule.Player, in.Player) {
+		return false
+	}
+	if rule.player != nil && (in.Player == "" || !rule.player.MatchString(in.Player)) {
+		return false
+	}
+	if rule.UUID != "" && rule.UUID != normalizeUUID(in.UUID) {
+		return false
+	}
+	if len(rule.networks) > 0 {
+		ip := net.ParseIP(in.IP)
+		found := false
+		for _, network := range rule.networks {
+			if ip != nil && network.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.MinProtocol > 0 && in.Protocol < rule.MinProtocol {
+		return false
+	}
+	if rule.MaxProtocol > 0 && in.Protocol > rule.MaxProtocol {
+		return false
+	}
+	if rule.hostname != nil && !rule.hostname.MatchString(in.Hostname) {
+		return false
+	}
+	if len(rule.Countries) > 0 {
+		found := false
+		for _, country := range rule.Countries {
+			if strings.EqualFold(country, in.Country) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if rule.Time != "" {
+		minute := in.Time.Hour()*60 + in.Time.Minute()
+		if rule.from <= rule.to {
+			if minute < rule.from || minute >= rule.to {
+				return false
+			}
+		} else if minute < rule.from && minute >= rule.to {
+			return false
+		}
+	}
+	if rule.days != nil && !rule.days[in.Time.Weekday()] {
+		return false
+	}
+	// 服务器列表请求没有玩家，登录次数为0，不能算作满足 max_attempts
+	if (rule.MinAttempts > 0 || rule.MaxAttempts > 0) && in.Player == "" {
+		return false
+	}
+	if rule.MinAttempts > 0 && in.Attempts < rule.MinAttempts {
+		return false
+	}
+	if rule.MaxAttempts > 0 && in.Attempts > rule.MaxAttempts {
+		return false
+	}
+	if rule.Client != "" && !strings.EqualFold(rule.Client, in.Client) {
+		return false
+	}
+	if rule.Entry != "" && rule.Entry != in.Entry {
+		return false
+	}
+	return true
+}
+
+// 按顺序找到第一个匹配的规则，没有匹配时返回-1
+func matchRules(rules []Rule, in RuleInput) (int, Rule) {
+	for i, rule := range rules {
+		if rule.match(in) {
+			return i, rule
+		}
+	}
+	return -1, Rule{Action: ruleBan}
+}
+
+// MatchRule 返回这些连接信息会匹配的规则和它在配置中的序号，没有匹配的规则时序号为-1
+// 没有填写的时间、国家、登录次数和UUID按当前时间、IP数据库和存储补全
+func (s *Server) MatchRule(in RuleInput) (int, Rule, error) {
+	if err := s.load(); err != nil {
+		return -1, Rule{}, err
+	}
+	if in.Time.IsZero() {
+		in.Time = time.Now()
+	}
+	if in.Country == "" && in.IP != "" {
+		in.Country = s.geoip.lookup(in.IP).Country
+	}
+	if in.Player != "" {
+		record := s.store.lookupName(in.Player)
+		if in.Attempts == 0 {
+			in.Attempts = record.Logins + 1
+		}
+		if in.UUID == "" {
+			in.UUID = playerUUID(in.Player, record)
+		}
+	}
+	index, rule := matchRules(s.rules, in)
+	return index, rule, nil
+}
+
+// ParseRuleInput 解析空格分隔的 key=value，例如 "player=Steve ip=10.0.0.1 protocol=767"
+// 可以使用的键: player、uuid、ip、protocol、hostname、country、time、attempts、client、entry
+// time 可以是 RFC3339 时间，也可以是今天的 HH:MM
+func ParseRuleInput(s string) (RuleInput, error) {
+	var in RuleInput
+	for _, field := range strings.Fields(s) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return in, newError("err.dry_run_field", field)
+		}
+
+		var err error
+		switch key {
+		case "player":
+			in.Player = value
+		case "uuid":
+			in.UUID = value
+		case "ip":
+			in.IP = value
+		case "protocol":
+			in.Protocol, err = strconv.Atoi(value)
+		case "hostname":
+			in.Hostname = value
+		case "country":
+			in.Country = value
+		case "time":
+			in.Time, err = parseRuleTime(value)
+		case "attempts":
+			in.Attempts, err = strconv.Atoi(value)
+		case "client":
+			in.Client = value
+		case "entry":
+			in.Entry = value
+		default:
+			return in, newError("err.dry_run_key", key)
+		}
+		if err != nil {
+			return in, newError("err.dry_run_value", key, value, err)
+		}
+	}
+	return in, nil
+}
+
+func parseRuleTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Local(), nil
+	}
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local), nil
+}
+
+// 连接目前为止的信息，服务器列表请求时没有玩家信息
+func (c *connection) ruleInput() RuleInput {
+	fingerprint := c.obs.clientFingerprint(c.server.clientSignatures)
+	in := RuleInput{
+		Player:   c.obs.Player,
+		IP:       c.obs.IP,
+		Protocol: c.protocol,
+		Hostname: cleanHostname(c.handshake.ServerAddress),
+		Country:  c.obs.Geo.Country,
+		Time:     time.Now(),
+		Client:   fingerprint.Client,
+		Entry:    fingerprint.Entry,
+	}
+	if in.Player != "" {
+		record := c.server.store.lookupName(in.Player)
+		in.Attempts = record.Logins + 1
+		in.UUID = c.ruleUUID()
+	}
+	return in
+}
+
+// 规则使用的UUID：验证之后使用会话服务器返回的UUID，离线模式按名称生成
+// 开启正版验证但还没有验证时为空，不使用存储中的UUID，避免用别人的名称冒充
+func (c *connection) ruleUUID() string {
+	if c.profile != nil {
+		return normalizeUUID(c.profile.ID)
+	}
+	if c.server.config.Auth.OnlineMode {
+		return ""
+	}
+	uuid := offlineUUID(c.obs.Player)
+	return hex.EncodeToString(uuid[:])
+}
+
+// 记录中的正版UUID，没有时按名称生成离线UUID
+func playerUUID(name string, record playerRecord) string {
+	if record.UUID != "" {
+		return record.UUID
+	}
+	uuid := offlineUUID(name)
+	return hex.EncodeToString(uuid[:])
+}
+
+// 选择这个连接的规则，匹配到的规则记录在日志中
+func (c *connection) selectRule() Rule {
+	index, rule := matchRules(c.server.rules, c.ruleInput())
+	if index >= 0 {
+		c.server.logf("log.rule_matched", c.obs.IP, rule.Name, rule.Action)
+	}
+	c.rule = rule
+	return rule
+}
@@ -0,0 +1,200 @@
+package fakeban
+
+import (
+	"testing"
+	"time"
+)
+
+func compileTestRules(t *testing.T, rules ...Rule) []Rule {
+	t.Helper()
+	cfg := DefaultConfig()
+	compiled, err := compileRules(rules, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compiled
+}
+
+// 2024-06-01 是星期六
+func ruleTime(clock string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", "2024-06-01 "+clock, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseTimeWindow(t *testing.T) {
+	tests := []struct {
+		window   string
+		from, to int
+		ok       bool
+	}{
+		{"09:00-17:30", 9 * 60, 17*60 + 30, true},
+		{"22:00-06:00", 22 * 60, 6 * 60, true},
+		{" 08:05 - 08:10 ", 8*60 + 5, 8*60 + 10, true},
+		{"09:00", 0, 0, false},
+		{"25:00-06:00", 0, 0, false},
+		{"09:00-9pm", 0, 0, false},
+	}
+	for _, tt := range tests {
+		from, to, err := parseTimeWindow(tt.window)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q 的错误为 %v", tt.window, err)
+			continue
+		}
+		if tt.ok && (from != tt.from || to != tt.to) {
+			t.Errorf("%q 解析为 %d-%d，应为 %d-%d", tt.window, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestCompileRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		ok   bool
+	}{
+		{"默认动作", Rule{}, true},
+		{"未知动作", Rule{Action: "kick"}, false},
+		{"转移需要目标", Rule{Action: ruleTransfer}, false},
+		{"玩家正则错误", Rule{PlayerPattern: "("}, false},
+		{"主机名正则错误", Rule{HostnamePattern: "["}, false},
+		{"单个IP", Rule{CIDRs: []string{"10.0.0.1", "::1"}}, true},
+		{"IP错误", Rule{CIDRs: []string{"10.0.0.300"}}, false},
+		{"IP段错误", Rule{CIDRs: []string{"10.0.0.0/33"}}, false},
+		{"时间段错误", Rule{Time: "22:00"}, false},
+		{"星期全称", Rule{Days: []string{"Saturday", "sun"}}, true},
+		{"星期错误", Rule{Days: []string{"someday"}}, false},
+		{"未知预设", Rule{Preset: "nope"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			_, err := compileRules([]Rule{tt.rule}, &cfg)
+			if (err == nil) != tt.ok {
+				t.Errorf("错误为 %v", err)
+			}
+		})
+	}
+
+	rules := compileTestRules(t, Rule{}, Rule{Name: "named"})
+	if rules[0].Name != "#1" || rules[1].Name != "named" {
+		t.Errorf("规则名称为 %q、%q，应为 #1、named", rules[0].Name, rules[1].Name)
+	}
+	if rules[0].Action != ruleBan {
+		t.Errorf("没有填写动作时为 %q，应为 ban", rules[0].Action)
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		in   RuleInput
+		want bool
+	}{
+		{"玩家名称不区分大小写", Rule{Player: "Steve"}, RuleInput{Player: "steve"}, true},
+		{"玩家正则", Rule{PlayerPattern: `^bot_\d+$`}, RuleInput{Player: "bot_12"}, true},
+		{"玩家正则不匹配状态请求", Rule{PlayerPattern: `.*`}, RuleInput{}, false},
+		{"单个IP", Rule{CIDRs: []string{"10.0.0.1"}}, RuleInput{IP: "10.0.0.1"}, true},
+		{"单个IP不匹配相邻地址", Rule{CIDRs: []string{"10.0.0.1"}}, RuleInput{IP: "10.0.0.2"}, false},
+		{"IP段", Rule{CIDRs: []string{"192.168.0.0/16"}}, RuleInput{IP: "192.168.3.4"}, true},
+		{"IPv6", Rule{CIDRs: []string{"2001:db8::/32"}}, RuleInput{IP: "2001:db8::1"}, true},
+		{"无效IP", Rule{CIDRs: []string{"0.0.0.0/0"}}, RuleInput{IP: "unknown"}, false},
+		{"协议范围内", Rule{MinProtocol: 47, MaxProtocol: 340}, RuleInput{Protocol: 340}, true},
+		{"协议低于范围", Rule{MinProtocol: 47, MaxProtocol: 340}, RuleInput{Protocol: 5}, false},
+		{"协议高于范围", Rule{MinProtocol: 47, MaxProtocol: 340}, RuleInput{Protocol: 767}, false},
+		{"只有最低协议", Rule{MinProtocol: 767}, RuleInput{Protocol: 770}, true},
+		{"主机名", Rule{HostnamePattern: `^mc\.`}, RuleInput{Hostname: "mc.example.com"}, true},
+		{"国家不区分大小写", Rule{Countries: []string{"DE", "cn"}}, RuleInput{Country: "CN"}, true},
+		{"国家不在列表中", Rule{Countries: []string{"DE"}}, RuleInput{Country: "US"}, false},
+		{"时间段内", Rule{Time: "09:00-17:00"}, RuleInput{Time: ruleTime("09:00")}, true},
+		{"时间段结束时不匹配", Rule{Time: "09:00-17:00"}, RuleInput{Time: ruleTime("17:00")}, false},
+		{"跨午夜的晚上", Rule{Time: "22:00-06:00"}, RuleInput{Time: ruleTime("23:30")}, true},
+		{"跨午夜的凌晨", Rule{Time: "22:00-06:00"}, RuleInput{Time: ruleTime("05:59")}, true},
+		{"跨午夜的白天", Rule{Time: "22:00-06:00"}, RuleInput{Time: ruleTime("12:00")}, false},
+		{"星期缩写", Rule{Days: []string{"sat"}}, RuleInput{Time: ruleTime("12:00")}, true},
+		{"星期全称", Rule{Days: []string{"Saturday"}}, RuleInput{Time: ruleTime("12:00")}, true},
+		{"其他星期", Rule{Days: []string{"mon", "tue"}}, RuleInput{Time: ruleTime("12:00")}, false},
+		{"登录次数下限", Rule{MinAttempts: 3}, RuleInput{Player: "Steve", Attempts: 3}, true},
+		{"登录次数不够", Rule{MinAttempts: 3}, RuleInput{Player: "Steve", Attempts: 2}, false},
+		{"登录次数上限", Rule{MaxAttempts: 3}, RuleInput{Player: "Steve", Attempts: 1}, true},
+		{"登录次数上限不匹配状态请求", Rule{MaxAttempts: 3}, RuleInput{}, false},
+		{"UUID带横线", Rule{UUID: testProfileID}, RuleInput{UUID: "069A79F4-44E9-4726-A5BE-FCA90E38AAF5"}, true},
+		{"客户端", Rule{Client: "forge"}, RuleInput{Client: "Forge"}, true},
+		{"连接方式", Rule{Entry: entryListJoin}, RuleInput{Entry: entryDirectConnect}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := compileTestRules(t, tt.rule)[0]
+			if got := rule.match(tt.in); got != tt.want {
+				t.Errorf("匹配结果为 %v，应为 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRulesOrder(t *testing.T) {
+	rules := compileTestRules(t,
+		Rule{Name: "local", CIDRs: []string{"127.0.0.1"}, Action: rulePass},
+		Rule{Name: "old", MaxProtocol: 340, Action: ruleOutdated},
+		Rule{Name: "any", Action: ruleThrottle},
+	)
+	tests := []struct {
+		in    RuleInput
+		index int
+		name  string
+	}{
+		{RuleInput{IP: "127.0.0.1", Protocol: 47}, 0, "local"},
+		{RuleInput{IP: "10.0.0.1", Protocol: 47}, 1, "old"},
+		{RuleInput{IP: "10.0.0.1", Protocol: 767}, 2, "any"},
+	}
+	for _, tt := range tests {
+		index, rule := matchRules(rules, tt.in)
+		if index != tt.index || rule.Name != tt.name {
+			t.Errorf("%+v 匹配到 %d %q，应为 %d %q", tt.in, index, rule.Name, tt.index, tt.name)
+		}
+	}
+
+	index, rule := matchRules(rules[:2], RuleInput{IP: "10.0.0.1", Protocol: 767})
+	if index != -1 || rule.Action != ruleBan {
+		t.Errorf("没有匹配时返回 %d %q，应为 -1 ban", index, rule.Action)
+	}
+}
+
+func TestParseRuleInput(t *testing.T) {
+	in, err := ParseRuleInput("player=Steve ip=10.0.0.1 protocol=767 hostname=mc.example.com country=DE time=2024-06-01T23:30:00Z attempts=3 client=forge entry=list_join uuid=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RuleInput{
+		Player:   "Steve",
+		UUID:     "abc",
+		IP:       "10.0.0.1",
+		Protocol: 767,
+		Hostname: "mc.example.com",
+		Country:  "DE",
+		Time:     time.Date(2024, 6, 1, 23, 30, 0, 0, time.UTC).Local(),
+		Attempts: 3,
+		Client:   "forge",
+		Entry:    "list_join",
+	}
+	if in != want {
+		t.Errorf("解析为 %+v，应为 %+v", in, want)
+	}
+
+	in, err = ParseRuleInput("time=23:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Time.Hour() != 23 || in.Time.Minute() != 30 || in.Time.Location() != time.Local {
+		t.Errorf("HH:MM 解析为 %v，应为今天本地时间 23:30", in.Time)
+	}
+
+	for _, bad := range []string{"player", "color=red", "protocol=new", "attempts=", "time=noon"} {
+		if _, err := ParseRuleInput(bad); err == nil {
+			t.Errorf("%q 应该报错", bad)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package fakeban
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 连接分类
+const (
+	classClient    = "client"    // 正常客户端
+	classScanner   = "scanner"   // 已知的扫描器特征
+	classProbe     = "probe"     // 不是Minecraft协议的TCP探测
+	classMalformed = "malformed" // 格式错误的数据包
+)
+
+// 单个IP最多记录的不同指纹数量
+const maxScannerFingerprints = 8
+
+// 单个连接的观察结果，连接结束时用来判断是否为扫描器
+type connObservation struct {
+	IP        string
+	Start     time.Time
+	FirstByte int // -1 表示没有收到任何数据
+	Handshake *Handshake
+	Malformed bool
+	Status    bool // 发送了状态请求
+	Pinged    bool // 发送了ping
+	Login     bool // 发送了登录开始包
+	Player    string
+	Brand     string // 配置阶段收到的客户端品牌
+	Geo       GeoLocation
+	// 依次收到的数据包，用于客户端指纹
+	Events      []connEvent
+	PingPayload int64
+	listJoin    bool
+}
+
+func newConnObservation(conn net.Conn) *connObservation {
+	return &connObservation{
+		IP:        remoteIP(conn),
+		Start:     time.Now(),
+		FirstByte: -1,
+	}
+}
+
+// 包装读取器，记录收到的第一个字节
+func (o *connObservation) reader(r io.Reader) io.Reader {
+	return &firstByteReader{r: r, obs: o}
+}
+
+type firstByteReader struct {
+	r   io.Reader
+	obs *connObservation
+}
+
+func (f *firstByteReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if n > 0 && f.obs.FirstByte < 0 {
+		f.obs.FirstByte = int(p[0])
+	}
+	return n, err
+}
+
+// 根据观察结果给连接分类，protocols 和 hostnames 是配置中扫描器的特征
+func (o *connObservation) classify(protocols []int, hostnames []*regexp.Regexp) string {
+	if o.FirstByte < 0 {
+		return classProbe
+	}
+	if o.Handshake == nil {
+		// 旧版ping(0xFE)和HTTP、TLS等其他协议都不会是合法的握手包
+		if o.FirstByte == 0xFE || !o.Malformed {
+			return classProbe
+		}
+		return classMalformed
+	}
+	if o.Malformed {
+		return classMalformed
+	}
+
+	for _, protocol := range protocols {
+		if o.Handshake.ProtocolVersion == protocol {
+			return classScanner
+		}
+	}
+	for _, pattern := range hostnames {
+		if pattern.MatchString(o.Handshake.ServerAddress) {
+			return classScanner
+		}
+	}
+
+	// 原版客户端在服务器列表里总是状态请求之后紧跟ping
+	if o.Status && !o.Pinged && !o.Login {
+		return classScanner
+	}
+	return classClient
+}
+
+// 生成连接的特征指纹，可读部分加上短哈希
+func (o *connObservation) fingerprint() string {
+	var parts []string
+	if o.FirstByte < 0 {
+		parts = append(parts, "first=none")
+	} else if o.Handshake == nil {
+		parts = append(parts, fmt.Sprintf("first=%#02x", o.FirstByte))
+	} else {
+		parts = append(parts,
+			"p="+strconv.Itoa(o.Handshake.ProtocolVersion),
+			"host="+hostKind(o.Handshake.ServerAddress),
+			"port="+strconv.Itoa(int(o.Handshake.Port)),
+			"next="+strconv.Itoa(o.Handshake.NextState),
+		)
+	}
+
+	flow := "none"
+	switch {
+	case o.Login:
+		flow = "login"
+	case o.Status && o.Pinged:
+		flow = "status+ping"
+	case o.Status:
+		flow = "status"
+	}
+	parts = append(parts, "flow="+flow)
+
+	readable := strings.Join(parts, ";")
+	sum := sha1.Sum([]byte(readable))
+	return readable + "#" + hex.EncodeToString(sum[:4])
+}
+
+// 握手包中服务器地址的类型
+func hostKind(address string) string {
+	address = strings.TrimSuffix(address, ".")
+	switch {
+	case address == "":
+		return "empty"
+	case strings.EqualFold(address, "localhost"):
+		return "localhost"
+	case net.ParseIP(address) != nil:
+		return "ip"
+	case strings.ContainsRune(address, 0):
+		return "marked"
+	default:
+		return "domain"
+	}
+}
+
+// 扫描器情报记录
+type scannerEntry struct {
+	IP           string    `json:"ip"`
+	Class        string    `json:"class"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	Count        int       `json:"count"`
+	Fingerprints []string  `json:"fingerprints"`
+	LastProtocol int       `json:"last_protocol"`
+	LastHostname string    `json:"last_hostname"`
+}
+
+// 扫描器情报日志，按IP汇总并定期写入文件
+type scannerIntel struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]*scannerEntry
+	dirty   bool
+}
+
+func compileScannerPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, newError("err.scanner_hostname", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// 读取已有的扫描器日志文件，文件不存在时从空日志开始
+// 日志文件只能是JSON，CSV只用于导出，读不回来
+func loadScannerIntel(path string) (*scannerIntel, error) {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return nil, newError("err.scanner_log_csv", path)
+	}
+	intel := &scannerIntel{path: path, entries: make(map[string]*scannerEntry)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return intel, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*scannerEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		intel.entries[entry.IP] = entry
+	}
+	return intel, nil
+}
+
+// 记录一个连接的观察结果，正常客户端不会被记录
+func (s *Server) observeScanner(obs *connObservation) {
+	class := obs.classify(s.config.Scanner.Protocols, s.scannerPatterns)
+	if class == classClient {
+		return
+	}
+	fingerprint := obs.fingerprint()
+	s.scannerLog.observe(obs, class, fingerprint)
+	s.logf("log.scanner", obs.IP, class, fingerprint)
+}
+
+func (s *scannerIntel) observe(obs *connObservation, class, fingerprint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry := s.entries[obs.IP]
+	if entry == nil {
+		entry = &scannerEntry{IP: obs.IP, FirstSeen: now}
+		s.entries[obs.IP] = entry
+	}
+	entry.Class = class
+	entry.LastSeen = now
+	entry.Count++
+	if obs.Handshake != nil {
+		entry.LastProtocol = obs.Handshake.ProtocolVersion
+		entry.LastHostname = obs.Handshake.ServerAddress
+	}
+
+	known := false
+	for _, f := range entry.Fingerprints {
+		if f == fingerprint {
+			known = true
+			break
+		}
+	}
+	if !known && len(entry.Fingerprints) < maxScannerFingerprints {
+		entry.Fingerprints = append(entry.Fingerprints, fingerprint)
+	}
+	s.dirty = true
+}
+
+// IP在 within 之内被识别为扫描器、探测或者格式错误的连接，within 为0时不过期
+// 动态IP换给正常玩家之后，旧的记录不再生效
+func (s *scannerIntel) flagged(ip string, within time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.entries[ip]
+	if entry == nil {
+		return false
+	}
+	return within <= 0 || time.Since(entry.LastSeen) < within
+}
+
+// 按首次出现时间排序的记录副本
+func (s *scannerIntel) snapshot() []scannerEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]scannerEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		e := *entry
+		e.Fingerprints = append([]string(nil), entry.Fingerprints...)
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].FirstSeen.Equal(entries[j].FirstSeen) {
+			return entries[i].IP < entries[j].IP
+		}
+		return entries[i].FirstSeen.Before(entries[j].FirstSeen)
+	})
+	return entries
+}
+
+// 有新记录时写回日志文件
+func (s *scannerIntel) save() error {
+	s.mu.Lock()
+	dirty := s.dirty
+	s.dirty = false
+	s.mu.Unlock()
+
+	if !dirty || s.path == "" {
+		return nil
+	}
+	return s.export(s.path)
+}
+
+// 导出日志，扩展名为.csv时导出CSV，否则导出JSON，log_file 总是JSON
+func (s *scannerIntel) export(path string) error {
+	entries := s.snapshot()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = writeScannerCSV(file, entries)
+	} else {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(entries)
+	}
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeScannerCSV(w io.Writer, entries []scannerEntry) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"ip", "class", "first_seen", "last_seen", "count", "last_protocol", "last_hostname", "fingerprints"})
+	for _, e := range entries {
+		writer.Write([]string{
+			e.IP,
+			e.Class,
+			e.FirstSeen.UTC().Format(time.RFC3339),
+			e.LastSeen.UTC().Format(time.RFC3339),
+			strconv.Itoa(e.Count),
+			strconv.Itoa(e.LastProtocol),
+			e.LastHostname,
+			strings.Join(e.Fingerprints, " "),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,572 @@
+// Package fakeban 实现假的 Minecraft 服务器：服务器列表中显示 Hypixel 的 MOTD，
+// 玩家进入时返回封禁消息。
+//
+// 用法和 net/http 类似，StatusHandler 决定服务器列表中显示的内容，
+// LoginHandler 决定玩家登录的结果：
+//
+//	server := &fakeban.Server{
+//		Addr: ":25565",
+//		Login: fakeban.LoginHandlerFunc(func(req *fakeban.LoginRequest) fakeban.LoginResult {
+//			return fakeban.Disconnect(fakeban.TextComponent{Text: "Hello " + req.Player})
+//		}),
+//	}
+//	server.ListenAndServe()
+//
+// 限流、扫描器识别、存储和统计等按 Config 工作，每个 Server 有自己的一份。
+package fakeban
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// 默认的连接超时
+const (
+	defaultTimeout          = 30 * time.Second
+	defaultThrottledTimeout = 5 * time.Second
+)
+
+// 服务器关闭后 Serve 和 ListenAndServe 返回这个错误
+var ErrServerClosed = newError("err.server_closed")
+
+// Server 假服务器，零值使用默认配置和默认的处理函数
+type Server struct {
+	// 监听地址，为空时使用配置中的 listen
+	Addr string
+	// 配置，为空时使用 DefaultConfig
+	Config *Config
+	// 生成服务器列表中显示的状态，为空时使用 DefaultStatusHandler
+	Status StatusHandler
+	// 决定玩家登录的结果，为空时使用 DefaultLoginHandler
+	Login LoginHandler
+	// 每一步等待客户端的超时，为0时使用30秒
+	Timeout time.Duration
+	// 被限流连接的超时，为0时使用5秒
+	ThrottledTimeout time.Duration
+	// 输出日志，为空时按行输出到标准输出
+	ErrorLog *log.Logger
+
+	loadOnce  sync.Once
+	loadErr   error
+	startOnce sync.Once
+	startErr  error
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	web       *http.Server
+	forms     formLimiter
+	loaded    bool
+	closed    bool
+	// 关闭时通知定期保存和重新加载的 goroutine 退出
+	done chan struct{}
+	// 处理连接、网页和定期保存的 goroutine，Close 等它们结束之后再保存
+	wg sync.WaitGroup
+
+	// 按配置读取的状态，load 之后不再替换
+	config           Config
+	limiter          *connLimiter
+	scannerPatterns  []*regexp.Regexp
+	scannerLog       *scannerIntel
+	clientSignatures []ClientSignature
+	hosts            map[string]HostProfile
+	rules            []Rule
+	catalogues       catalogueSet
+	geoip            *geoDatabase
+	resourcePack     *resourcePackData
+	store            *dataStore
+	cookieSecret     []byte
+	stats            *statsCounter
+	connectionLog    connectionLog
+	listPings        listPings
+	tarpit           tarpitUsage
+}
+
+// StatusRequest 一次服务器列表请求
+type StatusRequest struct {
+	IP        string
+	Handshake Handshake
+	// IP数据库中查到的位置
+	Geo GeoLocation
+	// 按主机名、国家和默认设置选择的语言
+	Locale string
+	// 握手地址对应的域名配置，没有配置时为空
+	Host HostProfile
+	// 匹配到的规则名称，没有匹配时为空
+	Rule string
+	// 规则或域名指定的MOTD在消息目录中的键，为空时使用 motd
+	MOTD string
+
+	// 处理这个请求的服务器，默认的处理函数用它的配置和消息目录
+	server *Server
+}
+
+// StatusHandler 生成服务器列表中显示的状态
+type StatusHandler interface {
+	ServeStatus(req *StatusRequest) StatusResponse
+}
+
+// StatusHandlerFunc 把普通函数用作 StatusHandler
+type StatusHandlerFunc func(req *StatusRequest) StatusResponse
+
+func (f StatusHandlerFunc) ServeStatus(req *StatusRequest) StatusResponse {
+	return f(req)
+}
+
+// LoginRequest 一次登录，包含握手和登录阶段收集到的信息
+type LoginRequest struct {
+	IP        string
+	Handshake Handshake
+	Player    string
+	// 客户端是被其他服务器转移过来的，握手中的下一个状态为3
+	Transferred bool
+	// 正版验证得到的玩家档案，离线登录时为空
+	Profile *GameProfile
+	// 通过Cookie认出的原来的玩家名称，没有关联时为空，登录次数和封禁ID都是原来的记录中的
+	LinkedPlayer string
+	// 这个玩家累计的登录次数，包括这一次
+	Logins int
+	// 这个玩家的封禁ID和升级封禁的级别，没有升级时级别为0
+	BanID    string
+	BanLevel int
+	// 揭晓状态: 空、reveal（这次显示揭晓界面）或 revealed（已经显示过）
+	Reveal string
+	// 申诉处理之后第一次登录时为 accepted 或 denied 和申诉编号，其他时候为空
+	Appeal   string
+	AppealID string
+	// Forge客户端的模组列表，其他客户端为空
+	Mods []ForgeMod
+	// 模组列表中第一个视为作弊的模组
+	CheatMod string
+	// 目前为止推测出的客户端类型
+	Client ClientFingerprint
+	// 配置阶段收到的客户端品牌和设置，没有进入配置阶段时为空
+	Brand string
+	Info  *ClientInformation
+	// IP数据库中查到的位置
+	Geo GeoLocation
+	// 按客户端设置、玩家记录、主机名、国家和默认设置选择的语言
+	Locale string
+	// 握手地址对应的域名配置，没有配置时为空
+	Host HostProfile
+	// 匹配到的规则名称，没有匹配时为空
+	Rule string
+	// 规则或域名指定的封禁消息在消息目录中的键，为空时使用 ban
+	Message string
+	// 资源包的结果: 空、accepted、declined 或 failed
+	ResourcePack string
+
+	// 处理这个请求的服务器，默认的处理函数用它的配置和消息目录
+	server *Server
+}
+
+// LoginResult 登录的结果，两个字段都为空时直接关闭连接
+type LoginResult struct {
+	// 断开连接时显示的消息
+	Disconnect *TextComponent
+	// 把客户端转移到另一个服务器，需要1.20.5及以上的客户端
+	Transfer *Transfer
+}
+
+// Transfer 转移的目标服务器
+type Transfer struct {
+	Host string
+	Port int
+}
+
+// Disconnect 返回显示 message 后断开连接的结果
+func Disconnect(message TextComponent) LoginResult {
+	return LoginResult{Disconnect: &message}
+}
+
+// LoginHandler 决定玩家登录的结果
+type LoginHandler interface {
+	ServeLogin(req *LoginRequest) LoginResult
+}
+
+// LoginHandlerFunc 把普通函数用作 LoginHandler
+type LoginHandlerFunc func(req *LoginRequest) LoginResult
+
+func (f LoginHandlerFunc) ServeLogin(req *LoginRequest) LoginResult {
+	return f(req)
+}
+
+// DefaultStatusHandler 显示 Hypixel 的 MOTD 和图标
+var DefaultStatusHandler StatusHandler = StatusHandlerFunc(hypixelStatus)
+
+// DefaultLoginHandler 按配置中的模板发送封禁消息
+var DefaultLoginHandler LoginHandler = LoginHandlerFunc(banLogin)
+
+func (s *Server) statusHandler() StatusHandler {
+	if s.Status != nil {
+		return s.Status
+	}
+	return DefaultStatusHandler
+}
+
+func (s *Server) loginHandler() LoginHandler {
+	if s.Login != nil {
+		return s.Login
+	}
+	return DefaultLoginHandler
+}
+
+func (s *Server) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return defaultTimeout
+}
+
+func (s *Server) throttledTimeout() time.Duration {
+	if s.ThrottledTimeout > 0 {
+		return s.ThrottledTimeout
+	}
+	return defaultThrottledTimeout
+}
+
+// 按配置读取扫描器日志、存储和统计，只执行一次
+func (s *Server) load() error {
+	s.loadOnce.Do(func() {
+		s.loadErr = s.loadConfig()
+		s.mu.Lock()
+		s.loaded = s.loadErr == nil
+		s.mu.Unlock()
+	})
+	return s.loadErr
+}
+
+func (s *Server) loadConfig() error {
+	s.config = DefaultConfig()
+	if s.Config != nil {
+		s.config = *s.Config
+	}
+	// 配置出错时按内置的消息目录输出错误信息
+	s.catalogues = builtinCatalogues
+	cfg := &s.config
+	s.limiter = newConnLimiter(cfg.RateLimit)
+
+	var err error
+	s.scannerPatterns, err = compileScannerPatterns(cfg.Scanner.HostnamePatterns)
+	if err != nil {
+		return newError("err.config", err)
+	}
+	s.scannerLog, err = loadScannerIntel(cfg.Scanner.LogFile)
+	if err != nil {
+		return newError("err.load_scanner_log", err)
+	}
+	s.clientSignatures, err = compileClientSignatures(cfg.ClientSignatures)
+	if err != nil {
+		return newError("err.config", err)
+	}
+	if err := checkEscalation(cfg.Escalation); err != nil {
+		return newError("err.config", err)
+	}
+	if err := checkReveal(cfg); err != nil {
+		return newError("err.config", err)
+	}
+	if err := checkCookies(cfg); err != nil {
+		return newError("err.config", err)
+	}
+	s.hosts, err = compileHosts(cfg.Hosts)
+	if err != nil {
+		return newError("err.config", err)
+	}
+	s.rules, err = compileRules(cfg.Rules, cfg)
+	if err != nil {
+		return newError("err.config", err)
+	}
+	// 模板出错时保留内置的消息目录，后面的错误信息还要用它输出
+	loaded, err := loadCatalogues(cfg.Locale.Messages, cfg.Ban.Lines)
+	if err != nil {
+		return newError("err.message_templates", err)
+	}
+	s.catalogues = loaded
+	if err := s.checkServerLinks(cfg.ServerLinks); err != nil {
+		return newError("err.config", err)
+	}
+	s.geoip, err = loadGeoIP(cfg.GeoIP.Database, s.logf)
+	if err != nil {
+		return newError("err.load_geoip", err)
+	}
+	s.resourcePack, err = loadResourcePack(cfg.ResourcePack, cfg.Web.Listen)
+	if err != nil {
+		return newError("err.load_pack", err)
+	}
+	s.store, err = loadStore(cfg.StoreFile, s.logf)
+	if err != nil {
+		return newError("err.load_store", err)
+	}
+	if cfg.Cookies.Enabled {
+		if err := s.loadCookieSecret(cfg); err != nil {
+			return newError("err.cookie_secret", err)
+		}
+	}
+	s.stats, err = loadStats(cfg.Log.StatsFile)
+	if err != nil {
+		return newError("err.load_stats", err)
+	}
+	return nil
+}
+
+// 打开连接日志、监听网页并开始定期保存，只执行一次
+func (s *Server) start() error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	s.startOnce.Do(func() {
+		if err := s.connectionLog.open(s.config.Log.ConnectionsFile); err != nil {
+			s.startErr = newError("err.open_connection_log", err)
+			return
+		}
+		if err := s.startWeb(); err != nil {
+			s.startErr = err
+			return
+		}
+		s.mu.Lock()
+		s.done = make(chan struct{})
+		done := s.done
+		s.mu.Unlock()
+		if s.config.Scanner.Enabled {
+			s.goTracked(func() { s.every(10*time.Second, done, "log.scanner_save_error", s.scannerLog.save) })
+		}
+		s.goTracked(func() { s.every(10*time.Second, done, "log.stats_save_error", s.stats.save) })
+		s.goTracked(func() { s.every(10*time.Second, done, "log.store_save_error", s.store.save) })
+		// 读取失败时继续使用旧的数据库
+		if s.config.GeoIP.Database != "" && s.config.GeoIP.ReloadSeconds > 0 {
+			reload := func() error {
+				_, err := s.geoip.reload()
+				return err
+			}
+			interval := time.Duration(s.config.GeoIP.ReloadSeconds) * time.Second
+			s.goTracked(func() { s.every(interval, done, "log.geoip_error", reload) })
+		}
+	})
+	return s.startErr
+}
+
+// 每隔 interval 调用一次 f，出错时按 key 输出日志，done 关闭时退出
+func (s *Server) every(interval time.Duration, done <-chan struct{}, key string, f func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := f(); err != nil {
+				s.logf(key, err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// 启动一个 Close 会等待的 goroutine，已经关闭时不启动
+func (s *Server) goTracked(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		f()
+	}()
+}
+
+// PrintStats 打印统计
+func (s *Server) PrintStats() error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.stats.print()
+	return nil
+}
+
+// ExportScanners 导出扫描器日志，格式由扩展名决定(.json或.csv)
+func (s *Server) ExportScanners(path string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	return s.scannerLog.export(path)
+}
+
+// ListenAndServe 监听 Addr 并处理连接
+func (s *Server) ListenAndServe() error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	addr := s.Addr
+	if addr == "" {
+		addr = s.config.Listen
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.logf("log.started", addr)
+	return s.Serve(listener)
+}
+
+// Serve 处理 listener 上的连接，可以对多个 listener 分别调用
+func (s *Server) Serve(listener net.Listener) error {
+	if err := s.start(); err != nil {
+		listener.Close()
+		return err
+	}
+	if !s.track(listener) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer func() {
+		s.untrack(listener)
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			s.logf("log.accept_error", err)
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		ip := remoteIP(conn)
+		release, ok := s.limiter.acquire(ip)
+		if !ok {
+			// 超出限制的连接只占用有限的处理名额，名额用完直接关闭
+			if !s.limiter.acquireThrottled() {
+				conn.Close()
+				continue
+			}
+			s.serveConn(conn, s.handleThrottled, s.limiter.releaseThrottled)
+			continue
+		}
+		s.serveConn(conn, s.handleConnection, release)
+	}
+}
+
+// 在新的 goroutine 中处理连接，结束后调用 release，Close 会关闭连接并等它结束
+func (s *Server) serveConn(conn net.Conn, handle func(net.Conn), release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		conn.Close()
+		release()
+		return
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			release()
+			s.wg.Done()
+		}()
+		handle(conn)
+	}()
+}
+
+// Close 关闭所有 listener、连接和网页，等处理它们的 goroutine 结束之后保存数据
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.done != nil && !s.closed {
+		close(s.done)
+	}
+	s.closed = true
+	for listener := range s.listeners {
+		listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.web != nil {
+		s.web.Close()
+	}
+	loaded := s.loaded
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	if !loaded {
+		return nil
+	}
+	s.connectionLog.close()
+
+	if s.config.Scanner.Enabled {
+		if err := s.scannerLog.save(); err != nil {
+			return err
+		}
+	}
+	if err := s.stats.save(); err != nil {
+		return err
+	}
+	return s.store.save()
+}
+
+func (s *Server) track(listener net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[listener] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(listener net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, listener)
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) handleConnection(rawConn net.Conn) {
+	conn := newPacketConn(rawConn)
+	obs := newConnObservation(conn)
+	obs.Geo = s.geoip.lookup(obs.IP)
+	resp := s.selectResponder(obs.IP, s.timeout())
+	defer func() {
+		if r := recover(); r != nil {
+			s.logf("log.connection_panic", r)
+		}
+		conn.Close()
+		resp.release()
+		if s.config.Scanner.Enabled {
+			s.observeScanner(obs)
+		}
+		s.recordConnection(obs)
+	}()
+
+	// 设置连接超时
+	conn.SetDeadline(time.Now().Add(s.timeout()))
+
+	newConnection(s, conn, obs, resp).serve()
+}
@@ -0,0 +1,108 @@
+package fakeban
+
+import (
+	"bytes"
+)
+
+// 1.21开始客户端在暂停菜单和断开连接界面显示服务器提供的链接
+const protocol1_21 = 767
+
+// 配置阶段的服务器链接数据包
+const configServerLinksID = 0x10 // 服务端 -> 客户端
+
+// 客户端内置的链接名称，按客户端中的顺序
+var builtinLinks = map[string]int{
+	"bug_report":           0,
+	"community_guidelines": 1,
+	"support":              2,
+	"status":               3,
+	"feedback":             4,
+	"community":            5,
+	"website":              6,
+	"forums":               7,
+	"news":                 8,
+	"announcements":        9,
+}
+
+// ServerLink 断开连接界面上显示的一个链接
+type ServerLink struct {
+	// 客户端内置的名称，例如 support、website，客户端按自己的语言显示
+	Type string `json:"type"`
+	// 没有 type 时显示的文字，消息目录中的键
+	Label string `json:"label"`
+	// 为空时使用 appeal_url
+	URL string `json:"url"`
+}
+
+// 没有配置 server_links 时发送的链接
+// 不放在默认配置中，否则配置文件中的链接会和默认的链接逐个合并
+var defaultServerLinks = []ServerLink{
+	{Label: "link_appeal"},
+	{Type: "community_guidelines", URL: "https://hypixel.net/rules"},
+}
+
+// 配置的服务器链接，配置为空数组时不发送
+func (s *Server) serverLinks() []ServerLink {
+	if s.config.ServerLinks == nil {
+		return defaultServerLinks
+	}
+	return s.config.ServerLinks
+}
+
+// 检查服务器链接的配置，label 要在默认语言或内置语言的消息目录中
+func (s *Server) checkServerLinks(links []ServerLink) error {
+	for i, link := range links {
+		switch {
+		case link.Type != "":
+			if _, ok := builtinLinks[link.Type]; !ok {
+				return newError("err.link_type", i+1, link.Type)
+			}
+		case link.Label == "":
+			return newError("err.link_label", i+1)
+		case s.lookupTemplate("", link.Label) == nil:
+			return newError("err.link_no_message", i+1, link.Label)
+		}
+	}
+	return nil
+}
+
+// 没有配置 appeal_url 也没有开启网页时使用的申诉地址
+const hypixelAppealURL = "https://www.hypixel.net/appeal"
+
+// 申诉页面的地址，消息模板中的 {{.AppealURL}}
+// 没有配置时指向网页上的申诉页面，域名和资源包一样取自握手地址
+func (s *Server) appealURL(address string) string {
+	if s.config.AppealURL != "" {
+		return s.config.AppealURL
+	}
+	if s.config.Web.Listen == "" || normalizeHostname(address) == "" {
+		return hypixelAppealURL
+	}
+	return s.webURL(address, "/appeal")
+}
+
+// 在断开连接之前发送服务器链接
+func sendServerLinks(c *connection) error {
+	data := new(bytes.Buffer)
+	links := c.server.serverLinks()
+	writeVarInt(data, len(links))
+	for _, link := range links {
+		if link.Type != "" {
+			data.WriteByte(1)
+			writeVarInt(data, builtinLinks[link.Type])
+		} else {
+			label, err := c.message(link.Label).forProtocol(c.protocol).marshalNBT()
+			if err != nil {
+				return newError("err.link_encode", err)
+			}
+			data.WriteByte(0)
+			data.Write(label)
+		}
+		url := link.URL
+		if url == "" {
+			url = c.server.appealURL(c.handshake.ServerAddress)
+		}
+		writeString(data, url)
+	}
+	return c.writePacket(configServerLinksID, data.Bytes())
+}
@@ -0,0 +1,57 @@
+package fakeban
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAppealURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		appealURL string
+		listen    string
+		address   string
+		want      string
+	}{
+		{"配置的地址", "https://appeal.example.com/appeal", ":8080", "mc.example.com", "https://appeal.example.com/appeal"},
+		{"没有网页", "", "", "mc.example.com", hypixelAppealURL},
+		{"网页端口", "", ":8080", "mc.example.com", "http://mc.example.com:8080/appeal"},
+		{"去掉Forge标记和端口", "", "0.0.0.0:8080", "MC.Example.com.\x00FML3\x00:25565", "http://mc.example.com:8080/appeal"},
+		{"IPv6", "", "[::]:8080", "::1", "http://[::1]:8080/appeal"},
+		{"没有握手地址", "", ":8080", "", hypixelAppealURL},
+	}
+	for _, tt := range tests {
+		s := &Server{config: DefaultConfig()}
+		s.config.AppealURL = tt.appealURL
+		s.config.Web.Listen = tt.listen
+		if got := s.appealURL(tt.address); got != tt.want {
+			t.Errorf("%s: 申诉地址为 %q，应为 %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckServerLinks(t *testing.T) {
+	tests := []struct {
+		name  string
+		links []ServerLink
+		ok    bool
+	}{
+		{"内置的链接", []ServerLink{{Type: "support"}, {Label: "link_appeal"}}, true},
+		{"未知类型", []ServerLink{{Type: "shop"}}, false},
+		{"没有类型和文字", []ServerLink{{URL: "https://example.com"}}, false},
+		{"消息目录中没有", []ServerLink{{Label: "link_shop"}}, false},
+		{"自己添加的消息", []ServerLink{{Label: "link_custom"}}, true},
+	}
+	for _, tt := range tests {
+		cfg := DefaultConfig()
+		cfg.StoreFile = filepath.Join(t.TempDir(), "store.json")
+		cfg.Log = LogConfig{}
+		cfg.Scanner.Enabled = false
+		cfg.ServerLinks = tt.links
+		cfg.Locale.Messages = map[string]map[string]Message{"en_us": {"link_custom": {"Custom"}}}
+		s := &Server{Config: &cfg}
+		if err := s.load(); (err == nil) != tt.ok {
+			t.Errorf("%s: 错误为 %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package fakeban
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 按维度统计的连接计数，例如 client=vanilla
+type statsCounter struct {
+	mu         sync.Mutex
+	path       string
+	Dimensions map[string]map[string]int `json:"dimensions"`
+	dirty      bool
+}
+
+// 读取已有的统计文件，文件不存在时从零开始
+func loadStats(path string) (*statsCounter, error) {
+	s := &statsCounter{path: path, Dimensions: make(map[string]map[string]int)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Dimensions == nil {
+		s.Dimensions = make(map[string]map[string]int)
+	}
+	return s, nil
+}
+
+func (s *statsCounter) add(dimension, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := s.Dimensions[dimension]
+	if values == nil {
+		values = make(map[string]int)
+		s.Dimensions[dimension] = values
+	}
+	values[value]++
+	s.dirty = true
+}
+
+// 有新计数时写回统计文件
+func (s *statsCounter) save() error {
+	s.mu.Lock()
+	if !s.dirty || s.path == "" {
+		s.mu.Unlock()
+		return nil
+	}
+	s.dirty = false
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
+
+// 按维度打印统计
+func (s *statsCounter) print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dimensions := make([]string, 0, len(s.Dimensions))
+	for dimension := range s.Dimensions {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Strings(dimensions)
+
+	for _, dimension := range dimensions {
+		fmt.Printf("%s:\n", dimension)
+		values := s.Dimensions[dimension]
+		keys := make([]string, 0, len(values))
+		for value := range values {
+			keys = append(keys, value)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return values[keys[i]] > values[keys[j]]
+		})
+		for _, value := range keys {
+			fmt.Printf("  %-24s %d\n", value, values[value])
+		}
+	}
+}
+
+// 连接日志中的一条记录
+type connectionRecord struct {
+	Time        time.Time         `json:"time"`
+	IP          string            `json:"ip"`
+	Class       string            `json:"class"`
+	Protocol    int               `json:"protocol,omitempty"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Player      string            `json:"player,omitempty"`
+	Country     string            `json:"country,omitempty"`
+	Fingerprint ClientFingerprint `json:"fingerprint"`
+}
+
+// 连接日志，每行一条JSON记录
+type connectionLog struct {
+	sync.Mutex
+	file *os.File
+}
+
+func (l *connectionLog) open(path string) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.file = file
+	return nil
+}
+
+func (l *connectionLog) close() {
+	l.Lock()
+	defer l.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// 连接结束时写入连接日志和统计
+func (s *Server) recordConnection(obs *connObservation) {
+	record := connectionRecord{
+		Time:        obs.Start,
+		IP:          obs.IP,
+		Class:       obs.classify(s.config.Scanner.Protocols, s.scannerPatterns),
+		Player:      obs.Player,
+		Country:     obs.Geo.Country,
+		Fingerprint: obs.clientFingerprint(s.clientSignatures),
+	}
+	if obs.Handshake != nil {
+		record.Protocol = obs.Handshake.ProtocolVersion
+		record.Hostname = obs.Handshake.ServerAddress
+	}
+
+	if obs.Handshake != nil {
+		s.logf("log.fingerprint",
+			obs.IP, record.Fingerprint.Client, record.Fingerprint.Entry, record.Fingerprint.Order)
+	}
+
+	s.stats.add("class", record.Class)
+	if record.Country != "" {
+		s.stats.add("country", record.Country)
+	}
+	if record.Class == classClient {
+		s.stats.add("client", record.Fingerprint.Client)
+		s.stats.add("entry", record.Fingerprint.Entry)
+	}
+
+	s.connectionLog.Lock()
+	defer s.connectionLog.Unlock()
+	if s.connectionLog.file == nil {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		s.logf("log.connection_log_encode_error", err)
+		return
+	}
+	if _, err := s.connectionLog.file.Write(append(data, '\n')); err != nil {
+		s.logf("log.connection_log_write_error", err)
+	}
+}
@@ -0,0 +1,236 @@
+package fakeban
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 玩家记录
+type playerRecord struct {
+	Name string `json:"name"`
+	// 通过正版验证的UUID，离线登录时为空
+	UUID       string            `json:"uuid,omitempty"`
+	Properties []ProfileProperty `json:"properties,omitempty"`
+	IPs        []string          `json:"ips"`
+	FirstSeen  time.Time         `json:"first_seen"`
+	LastSeen   time.Time         `json:"last_seen"`
+	Logins     int               `json:"logins"`
+	// 客户端上次发送的语言，下次登录时在收到客户端信息之前使用
+	Locale string `json:"locale,omitempty"`
+	// 封禁消息中显示的封禁ID，升级封禁时换成新的ID
+	BanID string `json:"ban_id,omitempty"`
+	// 升级封禁的级别和最近的登录时间，安静一段时间后清零
+	BanLevel int         `json:"ban_level,omitempty"`
+	Attempts []time.Time `json:"attempts,omitempty"`
+	// 这个玩家自己的揭晓条件，为空时使用 reveal 配置
+	RevealAttempts int        `json:"reveal_attempts,omitempty"`
+	RevealAt       *time.Time `json:"reveal_at,omitempty"`
+	// 满足揭晓条件的时间和是否已经显示过揭晓界面
+	RevealedAt  *time.Time `json:"revealed_at,omitempty"`
+	RevealShown bool       `json:"reveal_shown,omitempty"`
+	// 通过Cookie认出的其他名称
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// 单个玩家最多记录的IP数量
+const maxPlayerIPs = 16
+
+// 持久化存储，整体保存为一个JSON文件
+type dataStore struct {
+	mu      sync.Mutex
+	path    string
+	Players map[string]*playerRecord `json:"players"`
+	// 恶作剧链接，键为子域名
+	Pranks map[string]*prankRecord `json:"pranks"`
+	// 申诉，键为申诉编号
+	Appeals map[string]*appealRecord `json:"appeals"`
+	// 通过Cookie关联的玩家，键为新的玩家记录键，值为原来的记录键
+	Links map[string]string `json:"links,omitempty"`
+	// 没有配置 cookies.secret 时生成的签名密钥
+	CookieSecret string `json:"cookie_secret,omitempty"`
+	dirty        bool
+	// 每个IP已经揭晓的玩家数量，状态请求按IP查询，第一次查询时建立
+	revealed map[string]int
+	// 升级封禁、揭晓和关联玩家时输出日志
+	logf func(key string, args ...any)
+}
+
+// 读取存储文件，文件不存在时从空存储开始
+func loadStore(path string, logf func(key string, args ...any)) (*dataStore, error) {
+	s := &dataStore{path: path, logf: logf, Players: make(map[string]*playerRecord), Pranks: make(map[string]*prankRecord), Links: make(map[string]string), Appeals: make(map[string]*appealRecord)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Players == nil {
+		s.Players = make(map[string]*playerRecord)
+	}
+	if s.Pranks == nil {
+		s.Pranks = make(map[string]*prankRecord)
+	}
+	if s.Links == nil {
+		s.Links = make(map[string]string)
+	}
+	if s.Appeals == nil {
+		s.Appeals = make(map[string]*appealRecord)
+	}
+	return s, nil
+}
+
+// 玩家记录的键，正版玩家使用UUID，离线玩家使用小写名称
+func playerKey(name string, profile *GameProfile) string {
+	if uuid := profile.UUID(); uuid != "" {
+		return uuid
+	}
+	return "offline:" + strings.ToLower(name)
+}
+
+// 关联过的玩家使用原来的记录键，调用方持有存储的锁
+func (s *dataStore) resolveKey(key string) string {
+	if linked, ok := s.Links[key]; ok {
+		return linked
+	}
+	return key
+}
+
+// 记录一次登录，返回记录的键和记录的副本
+// linked 是Cookie中原来的记录键，和这次的记录不同时这次登录记在原来的记录上
+func (s *dataStore) recordLogin(name string, profile *GameProfile, ip, linked string, cfg *Config) (string, playerRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	key := s.resolveKey(playerKey(name, profile))
+	if linked != "" && linked != key && s.Players[linked] != nil {
+		s.link(playerKey(name, profile), linked, name)
+		key = linked
+	}
+	record := s.Players[key]
+	if record == nil {
+		record = &playerRecord{FirstSeen: now}
+		s.Players[key] = record
+	}
+	s.indexReveal(record, -1)
+	defer s.indexReveal(record, 1)
+
+	if key == playerKey(name, profile) {
+		record.Name = name
+		if profile != nil {
+			record.Name = profile.Name
+			record.UUID = profile.UUID()
+			record.Properties = profile.Properties
+		}
+	}
+	record.Logins++
+	if record.BanID == "" {
+		record.BanID = newBanID()
+	}
+	if cfg.Escalation.Enabled && escalate(record, cfg.Escalation, now) {
+		s.logf("log.ban_escalated", record.Name, record.BanLevel, record.BanID)
+	}
+	if cfg.Reveal.Enabled && checkRevealCondition(record, cfg.Reveal, now) {
+		s.logf("log.reveal_ready", record.Name)
+	}
+	record.LastSeen = now
+
+	known := false
+	for _, existing := range record.IPs {
+		if existing == ip {
+			known = true
+			break
+		}
+	}
+	if !known {
+		record.IPs = append(record.IPs, ip)
+		if len(record.IPs) > maxPlayerIPs {
+			record.IPs = record.IPs[len(record.IPs)-maxPlayerIPs:]
+		}
+	}
+	s.dirty = true
+
+	return key, record.copy()
+}
+
+// 记录的副本，切片不和存储共用
+func (r *playerRecord) copy() playerRecord {
+	copied := *r
+	copied.IPs = append([]string(nil), r.IPs...)
+	copied.Attempts = append([]time.Time(nil), r.Attempts...)
+	copied.Aliases = append([]string(nil), r.Aliases...)
+	return copied
+}
+
+// 按名称查找玩家记录，正版和离线记录都有时使用最近登录的，没有记录时返回空记录
+func (s *dataStore) lookupName(name string) playerRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *playerRecord
+	for _, record := range s.Players {
+		if record.hasName(name) && (found == nil || record.LastSeen.After(found.LastSeen)) {
+			found = record
+		}
+	}
+	if found == nil {
+		return playerRecord{}
+	}
+	return found.copy()
+}
+
+// 记录玩家客户端的语言
+func (s *dataStore) setLocale(name string, profile *GameProfile, locale string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.Players[s.resolveKey(playerKey(name, profile))]
+	if record == nil || record.Locale == locale {
+		return
+	}
+	record.Locale = locale
+	s.dirty = true
+}
+
+// 有修改时写回存储文件
+func (s *dataStore) save() error {
+	s.mu.Lock()
+	if !s.dirty || s.path == "" {
+		s.mu.Unlock()
+		return nil
+	}
+	s.dirty = false
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.mu.Unlock()
+	if err == nil {
+		err = s.writeFile(data)
+	}
+	if err != nil {
+		// 没有写成功，下次保存时重试
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// 先写临时文件再替换，避免写到一半时退出导致文件损坏
+// 存储中有Cookie密钥和玩家IP，只允许自己读写
+func (s *dataStore) writeFile(data []byte) error {
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
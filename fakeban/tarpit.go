@@ -0,0 +1,171 @@
+package fakeban
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// 发送的数据包类型，响应策略可以对不同的包区别处理
+type packetKind int
+
+const (
+	packetStatus packetKind = iota
+	packetPong
+	packetDisconnect
+)
+
+// 响应策略，决定状态信息的内容以及数据包以什么方式发给客户端
+type responder interface {
+	// 调整发送给这个连接的状态信息
+	status(StatusResponse) StatusResponse
+	// 发送一个完整的数据包
+	send(conn net.Conn, kind packetKind, packet []byte) error
+	// 连接结束时释放占用的资源
+	release()
+}
+
+// 正常响应，直接写入连接
+type normalResponder struct {
+	// 写入超时
+	timeout time.Duration
+}
+
+func (normalResponder) status(status StatusResponse) StatusResponse {
+	return status
+}
+
+func (r normalResponder) send(conn net.Conn, kind packetKind, packet []byte) error {
+	conn.SetDeadline(time.Now().Add(r.timeout))
+	_, err := conn.Write(packet)
+	return err
+}
+
+func (normalResponder) release() {}
+
+// 焦油坑模式
+const (
+	tarpitDrip   = "drip"   // 状态和断开连接消息每次只发送一个字节
+	tarpitStall  = "stall"  // pong拖到最长时间之后才发送
+	tarpitAbsurd = "absurd" // 显示离谱的在线人数和MOTD
+)
+
+// 焦油坑占用的连接数和缓冲区字节数
+type tarpitUsage struct {
+	conns atomic.Int64
+	bytes atomic.Int64
+}
+
+// 拖慢扫描器和滥用连接的响应策略
+type tarpitResponder struct {
+	cfg      TarpitConfig
+	usage    *tarpitUsage
+	start    time.Time
+	timeout  time.Duration
+	reserved int64
+	// 服务器关闭时不再拖延
+	done <-chan struct{}
+}
+
+// 为连接选择响应策略，被标记的IP在焦油坑还有名额时进入焦油坑
+func (s *Server) selectResponder(ip string, timeout time.Duration) responder {
+	cfg := s.config.Tarpit
+	if !cfg.Enabled || !s.tarpitFlagged(ip) {
+		return normalResponder{timeout: timeout}
+	}
+
+	if s.tarpit.conns.Add(1) > int64(cfg.MaxConns) {
+		s.tarpit.conns.Add(-1)
+		return normalResponder{timeout: timeout}
+	}
+
+	s.logf("log.tarpit", ip)
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	return &tarpitResponder{cfg: cfg, usage: &s.tarpit, start: time.Now(), timeout: timeout, done: done}
+}
+
+// IP被扫描器识别或者限流器标记过
+func (s *Server) tarpitFlagged(ip string) bool {
+	return s.scannerLog.flagged(ip, time.Duration(s.config.Tarpit.FlagHours)*time.Hour) || s.limiter.abusive(ip)
+}
+
+func (t *tarpitResponder) enabled(mode string) bool {
+	for _, m := range t.cfg.Modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tarpitResponder) status(status StatusResponse) StatusResponse {
+	if !t.enabled(tarpitAbsurd) {
+		return status
+	}
+	status.Players.Max = t.cfg.AbsurdMax
+	status.Players.Online = t.cfg.AbsurdOnline
+	status.Description.Text = t.cfg.AbsurdMOTD
+	return status
+}
+
+// 连接在焦油坑里最晚的结束时间
+func (t *tarpitResponder) deadline() time.Time {
+	return t.start.Add(time.Duration(t.cfg.MaxSeconds) * time.Second)
+}
+
+func (t *tarpitResponder) send(conn net.Conn, kind packetKind, packet []byte) error {
+	// 缓冲区总量超过上限时不再拖延，直接断开
+	size := int64(len(packet))
+	if t.usage.bytes.Add(size) > int64(t.cfg.MaxBytes) {
+		t.usage.bytes.Add(-size)
+		return newError("err.tarpit_full")
+	}
+	t.reserved += size
+
+	if kind == packetPong && t.enabled(tarpitStall) {
+		t.wait(conn, time.Until(t.deadline())-time.Second)
+	}
+
+	if kind != packetPong && t.enabled(tarpitDrip) {
+		interval := time.Duration(t.cfg.DripIntervalMillis) * time.Millisecond
+		for i := range packet {
+			if time.Now().After(t.deadline()) {
+				return newError("err.tarpit_timeout")
+			}
+			conn.SetDeadline(time.Now().Add(interval + 5*time.Second))
+			if _, err := conn.Write(packet[i : i+1]); err != nil {
+				return err
+			}
+			time.Sleep(interval)
+		}
+		return nil
+	}
+
+	conn.SetDeadline(time.Now().Add(t.timeout))
+	_, err := conn.Write(packet)
+	return err
+}
+
+// 等待指定时间，期间不断延长连接的超时，服务器关闭时提前返回
+func (t *tarpitResponder) wait(conn net.Conn, d time.Duration) {
+	end := time.Now().Add(d)
+	for time.Now().Before(end) {
+		step := time.Until(end)
+		if step > 5*time.Second {
+			step = 5 * time.Second
+		}
+		conn.SetDeadline(time.Now().Add(step + 5*time.Second))
+		select {
+		case <-time.After(step):
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *tarpitResponder) release() {
+	t.usage.bytes.Add(-t.reserved)
+	t.usage.conns.Add(-1)
+}
@@ -0,0 +1,51 @@
+package fakeban
+
+import (
+	"strings"
+)
+
+// 消息模板可以使用的变量，服务器列表的MOTD只有IP、Protocol、Hostname、位置和Locale
+type messageData struct {
+	Player   string
+	IP       string
+	Protocol int
+	Hostname string
+	// 国家、城市和时区，例如 .Country、.City、.TimeZone
+	GeoLocation
+	Client ClientFingerprint
+	// 正版验证得到的UUID和皮肤地址，离线登录时为空
+	UUID    string
+	SkinURL string
+	// 这个玩家累计的登录次数
+	Logins int
+	// 封禁ID和升级封禁的级别
+	BanID    string
+	BanLevel int
+	// Forge客户端的模组列表，其他客户端为空
+	Mods []ForgeMod
+	// 模组列表中第一个视为作弊的模组
+	CheatMod string
+	// 配置阶段收到的客户端品牌，没有进入配置阶段时为空
+	Brand string
+	// 资源包的结果: 空、accepted、declined 或 failed
+	ResourcePack string
+	// 渲染消息使用的语言
+	Locale string
+	// 客户端的视距和显示的皮肤部分，没有进入配置阶段时为0
+	ViewDistance int
+	SkinParts    byte
+	// 域名配置中的变量，恶作剧链接有 Victim 和 Reason
+	Vars map[string]string
+	// 申诉页面的地址，渲染时填写
+	AppealURL string
+	// 申诉编号，只有显示申诉结果时才有
+	AppealID string
+}
+
+// 去掉握手地址中的Forge标记和末尾的点
+func cleanHostname(address string) string {
+	if i := strings.IndexByte(address, 0); i >= 0 {
+		address = address[:i]
+	}
+	return strings.TrimSuffix(address, ".")
+}
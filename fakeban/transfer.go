@@ -0,0 +1,57 @@
+package fakeban
+
+import (
+	"bytes"
+)
+
+// 配置阶段的转移数据包，1.20.5开始才有
+const configTransferID = 0x0B // 服务端 -> 客户端
+
+// 把客户端转移到另一个服务器
+// 还在登录阶段时先发送登录成功，客户端回复 Login Acknowledged 进入配置阶段后再发送转移数据包
+func (c *connection) transferTo(target *Transfer) error {
+	if c.protocol < protocol1_20_5 {
+		c.server.logf("log.transfer_unsupported", c.obs.Player, target.Host, target.Port)
+		c.close()
+		return nil
+	}
+	if c.state == stateConfiguration {
+		return sendTransfer(c, target)
+	}
+
+	c.transfer = target
+	if err := sendLoginSuccess(c); err != nil {
+		return newError("err.send_login_success", err)
+	}
+	c.await(clientInformationTimeout, nil)
+	return nil
+}
+
+// 发送转移数据包并结束连接
+func sendTransfer(c *connection, target *Transfer) error {
+	data := new(bytes.Buffer)
+	writeString(data, target.Host)
+	writeVarInt(data, target.Port)
+	if err := c.writePacket(configTransferID, data.Bytes()); err != nil {
+		return newError("err.send_transfer", err)
+	}
+	c.server.logf("log.transfer_sent", c.obs.Player, target.Host, target.Port)
+	c.close()
+	return nil
+}
+
+// transfer 动作的规则转移到 transfer_target
+// 不支持转移的客户端在配置了 backend 时转发，否则和没有匹配规则一样处理
+func (c *connection) transferRule(data []byte) (bool, error) {
+	host, port, err := parseTransferTarget(c.server.config.TransferTarget)
+	if err != nil {
+		return false, err
+	}
+	if c.protocol >= protocol1_20_5 {
+		return true, c.transferTo(&Transfer{Host: host, Port: port})
+	}
+	if c.server.config.Backend != "" {
+		return true, c.passThrough(loginStartID, data)
+	}
+	return false, nil
+}
@@ -0,0 +1,105 @@
+package fakeban
+
+import (
+	"strings"
+	"time"
+)
+
+// 封禁消息的模式
+const (
+	// 按消息目录中的 ban 模板生成文字
+	banModeText = "text"
+	// 使用原版的翻译键，由客户端按自己的语言显示
+	banModeTranslate = "translate"
+)
+
+// 1.12开始服务器的断开连接消息改用翻译组件，之前的客户端没有这些键
+const protocol1_12 = 335
+
+// 原版封禁消息的翻译键和客户端没有这个键时显示的英文
+const (
+	bannedReasonKey      = "multiplayer.disconnect.banned.reason"
+	bannedExpirationKey  = "multiplayer.disconnect.banned.expiration"
+	bannedIPReasonKey    = "multiplayer.disconnect.banned_ip.reason"
+	bannedReasonText     = "You are banned from this server.\nReason: %s"
+	bannedExpirationText = "\nYour ban will be removed on %s"
+	bannedIPReasonText   = "Your IP address is banned from this server.\nReason: %s"
+	bannedDateFormat     = "2006-01-02 15:04:05 -0700" // 和原版封禁列表的日期格式相同
+)
+
+// 1.12加入的原版翻译键，之后的版本没有改过名称，更早的客户端改为显示 Fallback
+// 其他键不做检查，原样发送
+var vanillaKeys = map[string]bool{
+	bannedReasonKey:     true,
+	bannedExpirationKey: true,
+	bannedIPReasonKey:   true,
+}
+
+// 这个协议版本的客户端是否认识这个翻译键
+func clientHasKey(key string, protocol int) bool {
+	return !vanillaKeys[key] || protocol >= protocol1_12
+}
+
+// VanillaBanMessage 原版的封禁消息，客户端按自己的语言显示，reason 原样填入
+// expires 为零值时是永久封禁，ip 为 true 时显示为IP封禁
+func VanillaBanMessage(reason string, expires time.Time, ip bool) TextComponent {
+	message := TextComponent{
+		Translate: bannedReasonKey,
+		With:      []TextComponent{{Text: reason}},
+		Fallback:  bannedReasonText,
+	}
+	if ip {
+		message.Translate = bannedIPReasonKey
+		message.Fallback = bannedIPReasonText
+	}
+	if !expires.IsZero() {
+		message.Extra = []TextComponent{{
+			Translate: bannedExpirationKey,
+			With:      []TextComponent{{Text: expires.Format(bannedDateFormat)}},
+			Fallback:  bannedExpirationText,
+		}}
+	}
+	return message
+}
+
+// 客户端不认识的翻译键改为用 Fallback 拼出文字
+func (c TextComponent) forProtocol(protocol int) TextComponent {
+	if c.Translate != "" {
+		if !clientHasKey(c.Translate, protocol) {
+			c = c.flatten()
+		}
+	}
+	c.With = componentsForProtocol(c.With, protocol)
+	c.Extra = componentsForProtocol(c.Extra, protocol)
+	return c
+}
+
+func componentsForProtocol(components []TextComponent, protocol int) []TextComponent {
+	if len(components) == 0 {
+		return components
+	}
+	converted := make([]TextComponent, len(components))
+	for i, component := range components {
+		converted[i] = component.forProtocol(protocol)
+	}
+	return converted
+}
+
+// 把翻译组件换成文字组件，Fallback 中的 %s 依次换成 With 中的参数
+func (c TextComponent) flatten() TextComponent {
+	parts := strings.Split(c.Fallback, "%s")
+	var extra []TextComponent
+	for i, part := range parts[1:] {
+		if i < len(c.With) {
+			extra = append(extra, c.With[i])
+		}
+		if part != "" {
+			extra = append(extra, TextComponent{Text: part})
+		}
+	}
+
+	c.Text = parts[0]
+	c.Extra = append(extra, c.Extra...)
+	c.Translate, c.With, c.Fallback = "", nil, ""
+	return c
+}
@@ -0,0 +1,128 @@
+package fakeban
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"os"
+	"strings"
+)
+
+// 没有匹配到其他域名时使用的配置
+const defaultHost = "*"
+
+// HostProfile 一个域名对应的服务器列表内容和封禁消息，没有填写的字段使用 Hypixel 的设置
+type HostProfile struct {
+	// 配置中的域名，例如 hyp.example、*.fake.example 或 *
+	Name string `json:"-"`
+	// 内置预设的名称，例如 hypixel_perm_ban，下面没有填写的字段使用预设的内容
+	Preset string `json:"preset"`
+	// 消息目录中的键，为空时使用 motd 和 ban，规则中指定的消息优先
+	MOTD    string `json:"motd"`
+	Message string `json:"message"`
+	// 64x64的PNG文件路径，也可以直接写 data:image/png;base64,...
+	Favicon string `json:"favicon"`
+	// 服务器列表中显示的版本名称和协议版本
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+	// 服务器列表中显示的人数
+	MaxPlayers    int `json:"max_players"`
+	OnlinePlayers int `json:"online_players"`
+	// 消息模板中的 {{.Vars.名称}}
+	Vars map[string]string `json:"vars"`
+}
+
+// 检查域名，读取图标并填充预设的内容
+func compileHosts(profiles map[string]HostProfile) (map[string]HostProfile, error) {
+	compiled := make(map[string]HostProfile, len(profiles))
+	for name, profile := range profiles {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if name != defaultHost && strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+			return nil, newError("err.host_pattern", name)
+		}
+		profile.Name = name
+		if profile.Favicon != "" {
+			favicon, err := loadFavicon(profile.Favicon)
+			if err != nil {
+				return nil, newError("err.host_favicon", name, err)
+			}
+			profile.Favicon = favicon
+		}
+		if profile.Preset != "" {
+			preset, ok := presets[profile.Preset]
+			if !ok {
+				return nil, newError("err.host_preset", name, profile.Preset)
+			}
+			profile = preset.apply(profile.Preset, profile)
+		}
+		compiled[name] = profile
+	}
+	return compiled, nil
+}
+
+// 读取PNG图标并转换为服务器列表使用的 data URL，客户端只显示64x64的图标
+func loadFavicon(favicon string) (string, error) {
+	if strings.HasPrefix(favicon, "data:") {
+		return favicon, nil
+	}
+	data, err := os.ReadFile(favicon)
+	if err != nil {
+		return "", err
+	}
+	image, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", newError("err.not_png", err)
+	}
+	if image.Width != 64 || image.Height != 64 {
+		return "", newError("err.favicon_size", image.Width, image.Height)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// 握手地址统一为小写的域名，去掉Forge标记、末尾的点和端口
+func normalizeHostname(address string) string {
+	hostname := strings.ToLower(cleanHostname(address))
+	if i := strings.LastIndexByte(hostname, ':'); i >= 0 && !strings.Contains(hostname[:i], ":") {
+		hostname = hostname[:i]
+	}
+	return hostname
+}
+
+// 按握手地址选择域名配置：完全相同的域名优先，其次是最长的通配符，最后是 *
+// 都没有时返回空的配置，恶作剧链接的子域名在选中的配置上替换封禁消息
+func (s *Server) lookupHost(address string) HostProfile {
+	hostname := normalizeHostname(address)
+	profile := s.matchHost(hostname)
+	if prank, ok := s.prankHost(hostname, profile); ok {
+		return prank
+	}
+	return profile
+}
+
+func (s *Server) matchHost(hostname string) HostProfile {
+	if profile, ok := s.hosts[hostname]; ok {
+		return profile
+	}
+	// a.b.example 依次检查 *.b.example、*.example
+	for rest := hostname; ; {
+		i := strings.IndexByte(rest, '.')
+		if i < 0 {
+			break
+		}
+		rest = rest[i+1:]
+		if profile, ok := s.hosts["*."+rest]; ok {
+			return profile
+		}
+	}
+	return s.hosts[defaultHost]
+}
+
+// 第一个不为空的消息目录键
+func firstKey(keys ...string) string {
+	for _, key := range keys {
+		if key != "" {
+			return key
+		}
+	}
+	return ""
+}
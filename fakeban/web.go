@@ -0,0 +1,235 @@
+package fakeban
+
+import (
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 网页读取请求的超时
+const webReadTimeout = 10 * time.Second
+
+// WebHandler 返回网页的处理函数，作为库使用时可以挂到自己的 http.Server 上
+// 第一次请求时读取配置，读取失败时返回500
+func (s *Server) WebHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prank", s.handlePrankPage)
+	mux.HandleFunc(packPath, s.handleResourcePack)
+	mux.HandleFunc("/admin", s.requireAdmin(s.handleAdminPage))
+	mux.HandleFunc("/admin/reveal", s.requireAdmin(s.handleAdminReveal))
+	mux.HandleFunc("/appeal", s.handleAppealPage)
+	mux.HandleFunc("/admin/appeals", s.requireAdmin(s.handleAdminAppeals))
+	mux.HandleFunc("/admin/appeal", s.requireAdmin(s.handleAdminAppeal))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.load(); err != nil {
+			s.logf("log.web_error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// 按 web.listen 启动网页，地址为空时不启动，监听失败时返回错误
+func (s *Server) startWeb() error {
+	addr := s.config.Web.Listen
+	if addr == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return newError("err.web_listen", addr, err)
+	}
+	web := &http.Server{
+		Handler:           s.WebHandler(),
+		ReadHeaderTimeout: webReadTimeout,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		listener.Close()
+		return nil
+	}
+	s.web = web
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := web.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logf("log.web_error", err)
+		}
+	}()
+	s.logf("log.web_started", addr)
+	return nil
+}
+
+// 网页上的地址，玩家连接时使用的域名加上网页的端口
+func (s *Server) webURL(address, path string) string {
+	_, port, err := net.SplitHostPort(s.config.Web.Listen)
+	if err != nil {
+		port = "80"
+	}
+	host := normalizeHostname(address)
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return "http://" + host + ":" + port + path
+}
+
+// 按IP限制表单的提交速率，否则不带令牌反复提交就能绕过每个令牌的链接数量上限
+type formLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func (l *formLimiter) allow(ip string, perHour int) bool {
+	if perHour <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= time.Minute {
+		l.lastSweep = now
+		for key, bucket := range l.buckets {
+			if bucket.full(now) {
+				delete(l.buckets, key)
+			}
+		}
+	}
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	bucket := l.buckets[ip]
+	if bucket == nil {
+		bucket = newTokenBucket(float64(perHour)/3600, perHour, now)
+		l.buckets[ip] = bucket
+	}
+	return bucket.allow(now)
+}
+
+// 按浏览器的 Accept-Language 选择网页的语言
+func (s *Server) requestLocale(r *http.Request) string {
+	var candidates []string
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, _, _ := strings.Cut(part, ";")
+		candidates = append(candidates, tag)
+	}
+	return s.selectLocale(candidates...)
+}
+
+// 网页上的文字，key 省略了 web. 前缀
+type webText struct {
+	server *Server
+	locale string
+}
+
+func (t webText) Get(key string) string {
+	text, err := t.server.renderMessage(t.locale, "web."+key, messageData{Locale: t.locale})
+	if err != nil {
+		t.server.logf("log.message_error", "web."+key, err)
+	}
+	return text
+}
+
+var prankPage = template.Must(template.New("prank").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Text.Get "prank_title"}}</title>
+<style>
+body { font-family: sans-serif; max-width: 32em; margin: 2em auto; padding: 0 1em; }
+label { display: block; margin: 1em 0 0.3em; }
+input { width: 100%; padding: 0.4em; box-sizing: border-box; }
+button { margin-top: 1em; padding: 0.5em 1.5em; }
+code { font-size: 1.2em; background: #eee; padding: 0.1em 0.3em; }
+.error { color: #c00; }
+</style>
+</head>
+<body>
+<h1>{{.Text.Get "prank_title"}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{with .Prank}}
+<p>{{$.Text.Get "prank_created"}} <code>{{.Hostname}}</code></p>
+<p>{{$.Text.Get "prank_expires"}} {{.Expires.Format "2006-01-02 15:04"}}</p>
+<p>{{$.Text.Get "prank_token_note"}} <code>{{.Token}}</code></p>
+{{end}}
+<form method="post">
+<label for="victim">{{.Text.Get "prank_victim"}}</label>
+<input id="victim" name="victim" maxlength="16" required value="{{.Victim}}">
+<label for="reason">{{.Text.Get "prank_reason"}}</label>
+<input id="reason" name="reason" maxlength="100" required value="{{.Reason}}">
+<label for="token">{{.Text.Get "prank_token"}}</label>
+<input id="token" name="token" value="{{.Token}}">
+<button type="submit">{{.Text.Get "prank_submit"}}</button>
+</form>
+</body>
+</html>
+`))
+
+// 恶作剧链接的表单，GET 显示表单，POST 创建链接
+func (s *Server) handlePrankPage(w http.ResponseWriter, r *http.Request) {
+	locale := s.requestLocale(r)
+	page := struct {
+		Locale string
+		Text   webText
+		Error  string
+		Prank  *Prank
+		Victim string
+		Reason string
+		Token  string
+	}{Locale: locale, Text: webText{s, locale}}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		page.Victim = r.PostFormValue("victim")
+		page.Reason = r.PostFormValue("reason")
+		page.Token = r.PostFormValue("token")
+		if !s.forms.allow(remoteHTTPIP(r), s.config.Web.FormsPerHour) {
+			page.Error = page.Text.Get("form_rate_limited")
+			w.WriteHeader(http.StatusTooManyRequests)
+			break
+		}
+		prank, err := s.CreatePrank(page.Victim, page.Reason, page.Token)
+		if err != nil {
+			page.Error = page.Text.Get(s.prankErrorKey(err))
+			w.WriteHeader(http.StatusBadRequest)
+			break
+		}
+		page.Prank = &prank
+		page.Token = prank.Token
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := prankPage.Execute(w, page); err != nil {
+		s.logf("log.web_error", err)
+	}
+}
+
+// 创建链接失败时网页上显示的消息，其他错误只记录在日志中
+func (s *Server) prankErrorKey(err error) string {
+	switch {
+	case errors.Is(err, errPrankDisabled):
+		return "prank_disabled"
+	case errors.Is(err, errPrankVictim):
+		return "prank_bad_victim"
+	case errors.Is(err, errPrankReason):
+		return "prank_bad_reason"
+	case errors.Is(err, errPrankLimit):
+		return "prank_limit"
+	}
+	s.logf("log.web_error", err)
+	return "prank_failed"
+}
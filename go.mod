@@ -0,0 +1,3 @@
+module github.com/numakkiyu/FakeHypixelBan
+
+go 1.21
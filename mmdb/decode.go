@@ -0,0 +1,211 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// 数据段中的类型
+const (
+	typeExtended  = 0
+	typePointer   = 1
+	typeString    = 2
+	typeDouble    = 3
+	typeBytes     = 4
+	typeUint16    = 5
+	typeUint32    = 6
+	typeMap       = 7
+	typeInt32     = 8
+	typeUint64    = 9
+	typeUint128   = 10
+	typeArray     = 11
+	typeContainer = 12
+	typeEndMarker = 13
+	typeBool      = 14
+	typeFloat     = 15
+)
+
+// 防止损坏的文件造成无限递归
+const maxDepth = 64
+
+var errOutOfRange = errors.New("mmdb: data out of range")
+
+// 数据段解码器，指针是相对 buf 开头的偏移
+type decoder struct {
+	buf []byte
+}
+
+// 解码 offset 处的值，返回值和紧跟在它后面的偏移
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("mmdb: nesting too deep")
+	}
+	typ, size, offset, err := d.controlByte(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+
+	switch typ {
+	case typeMap:
+		// 长度来自文件，损坏的文件可能声明很大的长度，预分配不超过1024项
+		m := make(map[string]any, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("mmdb: map key is not a string")
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[name] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errOutOfRange
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("mmdb: invalid double size: %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("mmdb: invalid float size: %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("mmdb: invalid integer size: %d", size)
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("mmdb: invalid integer size: %d", size)
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		// 不足4个字节时高位补0，按32位补码解释
+		return int32(v), next, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("mmdb: invalid integer size: %d", size)
+		}
+		return new(big.Int).SetBytes(b), next, nil
+	case typeBool:
+		// 布尔值直接存在长度中，没有数据
+		return size != 0, offset, nil
+	}
+	return nil, 0, fmt.Errorf("mmdb: unsupported type: %d", typ)
+}
+
+// 读取控制字节，返回类型、长度和数据开始的偏移
+func (d decoder) controlByte(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errOutOfRange
+	}
+	ctrl := d.buf[offset]
+	offset++
+
+	typ := int(ctrl >> 5)
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errOutOfRange
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	// 指针的长度字段有不同的含义，由 pointer 处理
+	size := uint(ctrl & 0x1f)
+	if typ == typePointer || size < 29 {
+		return typ, size, offset, nil
+	}
+
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, 0, errOutOfRange
+	}
+	var extra uint
+	for _, c := range d.buf[offset : offset+n] {
+		extra = extra<<8 | uint(c)
+	}
+	offset += n
+
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return typ, size, offset, nil
+}
+
+// 读取指针，返回指向的偏移和指针之后的偏移
+func (d decoder) pointer(size, offset uint) (uint, uint, error) {
+	n := (size>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errOutOfRange
+	}
+	var v uint
+	if n < 4 {
+		v = size & 0x7
+	}
+	for _, c := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(c)
+	}
+
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
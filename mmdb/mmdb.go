@@ -0,0 +1,227 @@
+// Package mmdb 读取 MaxMind DB 格式（.mmdb）的 IP 数据库，例如 GeoLite2-Country 和 GeoLite2-City。
+//
+// 整个文件读入内存，查询不访问网络也不访问磁盘。查询结果按数据段中的类型解码为 Go 值：
+//
+//	map          map[string]any
+//	array        []any
+//	UTF-8 string string
+//	double       float64
+//	float        float32
+//	bytes        []byte
+//	uint16/32/64 uint64
+//	uint128      *big.Int
+//	int32        int32
+//	boolean      bool
+//
+// 格式说明见 https://maxmind.github.io/MaxMind-DB/
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// 元数据段以这个标记开头，位于文件末尾
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// 元数据段最大128KiB
+const maxMetadataSize = 128 * 1024
+
+// 搜索树和数据段之间有16个字节的0
+const dataSectionSeparator = 16
+
+// Metadata 数据库的元数据
+type Metadata struct {
+	BinaryFormatMajorVersion uint64
+	BinaryFormatMinorVersion uint64
+	BuildEpoch               uint64
+	DatabaseType             string
+	Description              map[string]string
+	IPVersion                uint64
+	Languages                []string
+	NodeCount                uint64
+	RecordSize               uint64
+}
+
+// Reader 读入内存的数据库，可以被多个 goroutine 同时查询
+type Reader struct {
+	Metadata Metadata
+
+	buf       []byte
+	data      decoder
+	nodeCount uint
+	treeSize  uint
+	ipv4Start uint
+}
+
+// Open 读取数据库文件
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes 从内存中的数据库创建 Reader，buf 之后不能再修改
+func FromBytes(buf []byte) (*Reader, error) {
+	start := len(buf) - maxMetadataSize
+	if start < 0 {
+		start = 0
+	}
+	i := bytes.LastIndex(buf[start:], metadataMarker)
+	if i < 0 {
+		return nil, errors.New("mmdb: metadata not found")
+	}
+	metadataStart := start + i + len(metadataMarker)
+
+	meta := decoder{buf: buf[metadataStart:]}
+	value, _, err := meta.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb: error reading metadata: %w", err)
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("mmdb: metadata is not a map")
+	}
+
+	r := &Reader{buf: buf}
+	r.Metadata = Metadata{
+		BinaryFormatMajorVersion: uintField(fields, "binary_format_major_version"),
+		BinaryFormatMinorVersion: uintField(fields, "binary_format_minor_version"),
+		BuildEpoch:               uintField(fields, "build_epoch"),
+		DatabaseType:             stringField(fields, "database_type"),
+		IPVersion:                uintField(fields, "ip_version"),
+		NodeCount:                uintField(fields, "node_count"),
+		RecordSize:               uintField(fields, "record_size"),
+	}
+	if description, ok := fields["description"].(map[string]any); ok {
+		r.Metadata.Description = make(map[string]string)
+		for language, text := range description {
+			if s, ok := text.(string); ok {
+				r.Metadata.Description[language] = s
+			}
+		}
+	}
+	if languages, ok := fields["languages"].([]any); ok {
+		for _, language := range languages {
+			if s, ok := language.(string); ok {
+				r.Metadata.Languages = append(r.Metadata.Languages, s)
+			}
+		}
+	}
+
+	if r.Metadata.BinaryFormatMajorVersion != 2 {
+		return nil, fmt.Errorf("mmdb: unsupported format version: %d", r.Metadata.BinaryFormatMajorVersion)
+	}
+	switch r.Metadata.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("mmdb: unsupported record size: %d", r.Metadata.RecordSize)
+	}
+
+	r.nodeCount = uint(r.Metadata.NodeCount)
+	r.treeSize = r.nodeCount * uint(r.Metadata.RecordSize) / 4
+	dataStart := r.treeSize + dataSectionSeparator
+	if dataStart > uint(start+i) {
+		return nil, errors.New("mmdb: search tree exceeds file size")
+	}
+	r.data = decoder{buf: buf[dataStart : start+i]}
+
+	// IPv6数据库中的IPv4地址位于 ::/96 之下
+	if r.Metadata.IPVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < r.nodeCount; j++ {
+			node, err = r.readNode(node, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Lookup 查询 IP 对应的记录，数据库中没有这个 IP 时返回 nil
+func (r *Reader) Lookup(ip net.IP) (any, error) {
+	offset, found, err := r.lookupOffset(ip)
+	if err != nil || !found {
+		return nil, err
+	}
+	value, _, err := r.data.decode(offset, 0)
+	return value, err
+}
+
+// 在搜索树中查找，返回记录在数据段中的偏移
+func (r *Reader) lookupOffset(ip net.IP) (uint, bool, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if ip = ip.To16(); ip == nil {
+		return 0, false, errors.New("mmdb: invalid IP address")
+	} else if r.Metadata.IPVersion == 4 {
+		return 0, false, errors.New("mmdb: cannot look up an IPv6 address in an IPv4 database")
+	}
+
+	node := uint(0)
+	if len(ip) == net.IPv4len {
+		node = r.ipv4Start
+	}
+	bits := len(ip) * 8
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		var err error
+		if node, err = r.readNode(node, bit); err != nil {
+			return 0, false, err
+		}
+	}
+
+	switch {
+	case node == r.nodeCount:
+		return 0, false, nil
+	case node > r.nodeCount:
+		offset := node - r.nodeCount - dataSectionSeparator
+		if offset >= uint(len(r.data.buf)) {
+			return 0, false, errors.New("mmdb: search tree points outside the data section")
+		}
+		return offset, true, nil
+	}
+	return 0, false, errors.New("mmdb: search tree has too few address bits")
+}
+
+// 读取节点的左(bit=0)或右(bit=1)记录
+func (r *Reader) readNode(node, bit uint) (uint, error) {
+	size := uint(r.Metadata.RecordSize)
+	base := node * size / 4
+	if base+size/4 > r.treeSize {
+		return 0, errors.New("mmdb: node outside the search tree")
+	}
+	b := r.buf[base : base+size/4]
+
+	switch size {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+	case 28:
+		// 中间字节的高4位属于左记录，低4位属于右记录
+		if bit == 0 {
+			return uint(b[3]>>4)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		b = b[bit*4:]
+		return uint(b[0])<<24 | uint(b[1])<<16 | uint(b[2])<<8 | uint(b[3]), nil
+	}
+}
+
+func uintField(fields map[string]any, name string) uint64 {
+	v, _ := fields[name].(uint64)
+	return v
+}
+
+func stringField(fields map[string]any, name string) string {
+	v, _ := fields[name].(string)
+	return v
+}
@@ -0,0 +1,334 @@
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// 测试用的数据段编码，只支持这里用到的类型，长度不超过28
+type field struct {
+	key   string
+	value any
+}
+
+type pointer uint
+
+func encodeControl(buf *bytes.Buffer, typ int, size int) {
+	if typ <= 7 {
+		buf.WriteByte(byte(typ<<5 | size))
+		return
+	}
+	buf.WriteByte(byte(size))
+	buf.WriteByte(byte(typ - 7))
+}
+
+func encodeValue(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case string:
+		encodeControl(buf, typeString, len(v))
+		buf.WriteString(v)
+	case uint64:
+		var b []byte
+		for ; v > 0; v >>= 8 {
+			b = append([]byte{byte(v)}, b...)
+		}
+		encodeControl(buf, typeUint64, len(b))
+		buf.Write(b)
+	case []any:
+		encodeControl(buf, typeArray, len(v))
+		for _, item := range v {
+			encodeValue(buf, item)
+		}
+	case []field:
+		encodeControl(buf, typeMap, len(v))
+		for _, f := range v {
+			encodeValue(buf, f.key)
+			encodeValue(buf, f.value)
+		}
+	case pointer:
+		// 只用1个字节的指针
+		buf.WriteByte(byte(typePointer<<5 | int(v>>8)&0x7))
+		buf.WriteByte(byte(v))
+	default:
+		panic("unsupported test value")
+	}
+}
+
+// 测试数据库中的一个网段，IPv6数据库中的IPv4网段放在 ::/96 之下
+type testNetwork struct {
+	cidr string
+	data uint // 数据段中的偏移
+}
+
+// 搜索树中记录的类型
+const (
+	recordEmpty = iota
+	recordNode
+	recordData
+)
+
+type testRecord struct {
+	kind  int
+	value uint
+}
+
+// 按网段建立搜索树并生成完整的数据库文件
+func buildDatabase(t *testing.T, recordSize, ipVersion int, networks []testNetwork, data []byte) []byte {
+	t.Helper()
+	nodes := [][2]testRecord{{}}
+	for _, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := ipNet.IP.To16()
+		ones, _ := ipNet.Mask.Size()
+		if ipNet.IP.To4() != nil && len(ipNet.IP) == net.IPv4len {
+			ones += 96
+			ip = append(make(net.IP, 12), ipNet.IP...)
+		}
+		if ipVersion == 4 {
+			ip = ip[12:]
+			ones -= 96
+		}
+
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - uint(i%8)) & 1
+			if i == ones-1 {
+				nodes[node][bit] = testRecord{recordData, network.data}
+				break
+			}
+			if nodes[node][bit].kind != recordNode {
+				nodes = append(nodes, [2]testRecord{})
+				nodes[node][bit] = testRecord{recordNode, uint(len(nodes) - 1)}
+			}
+			node = int(nodes[node][bit].value)
+		}
+	}
+
+	nodeCount := uint(len(nodes))
+	value := func(r testRecord) uint {
+		switch r.kind {
+		case recordNode:
+			return r.value
+		case recordData:
+			return nodeCount + dataSectionSeparator + r.value
+		}
+		return nodeCount
+	}
+
+	var file bytes.Buffer
+	for _, n := range nodes {
+		left, right := value(n[0]), value(n[1])
+		switch recordSize {
+		case 24:
+			file.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			file.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>24)<<4 | byte(right>>24)&0x0f, byte(right >> 16), byte(right >> 8), byte(right)})
+		case 32:
+			file.Write([]byte{byte(left >> 24), byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 24), byte(right >> 16), byte(right >> 8), byte(right)})
+		}
+	}
+	file.Write(make([]byte, dataSectionSeparator))
+	file.Write(data)
+	file.Write(metadataMarker)
+	encodeValue(&file, []field{
+		{"binary_format_major_version", uint64(2)},
+		{"binary_format_minor_version", uint64(0)},
+		{"build_epoch", uint64(1700000000)},
+		{"database_type", "Test-Country"},
+		{"description", []field{{"en", "test database"}}},
+		{"ip_version", uint64(ipVersion)},
+		{"languages", []any{"en", "de"}},
+		{"node_count", uint64(nodeCount)},
+		{"record_size", uint64(recordSize)},
+	})
+	return file.Bytes()
+}
+
+// 数据段：国家记录，以及通过指针引用它的德国记录和柏林记录
+func testData() ([]byte, uint, uint) {
+	var data bytes.Buffer
+	country := pointer(data.Len())
+	encodeValue(&data, []field{{"iso_code", "DE"}})
+	germany := uint(data.Len())
+	encodeValue(&data, []field{{"country", country}})
+	city := uint(data.Len())
+	encodeValue(&data, []field{
+		{"city", []field{{"names", []field{{"en", "Berlin"}}}}},
+		{"country", country},
+	})
+	return data.Bytes(), germany, city
+}
+
+func TestLookup(t *testing.T) {
+	data, germany, city := testData()
+	de := map[string]any{"country": map[string]any{"iso_code": "DE"}}
+	berlin := map[string]any{
+		"city":    map[string]any{"names": map[string]any{"en": "Berlin"}},
+		"country": map[string]any{"iso_code": "DE"},
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		db := buildDatabase(t, recordSize, 6, []testNetwork{
+			{"1.2.3.0/24", germany},
+			{"2001:db8::/32", city},
+		}, data)
+		r, err := FromBytes(db)
+		if err != nil {
+			t.Fatalf("%d位记录: %v", recordSize, err)
+		}
+		if r.Metadata.DatabaseType != "Test-Country" || r.Metadata.Description["en"] != "test database" ||
+			!reflect.DeepEqual(r.Metadata.Languages, []string{"en", "de"}) || r.Metadata.RecordSize != uint64(recordSize) {
+			t.Errorf("%d位记录的元数据为 %+v", recordSize, r.Metadata)
+		}
+
+		tests := []struct {
+			ip   string
+			want any
+		}{
+			{"1.2.3.4", de},
+			{"::ffff:1.2.3.4", de},
+			{"::1.2.3.4", de},
+			{"1.2.4.4", nil},
+			{"2001:db8:1::1", berlin},
+			{"2001:db9::1", nil},
+		}
+		for _, tt := range tests {
+			got, err := r.Lookup(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Errorf("%d位记录查询 %s: %v", recordSize, tt.ip, err)
+				continue
+			}
+			if tt.want == nil && got != nil || tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%d位记录查询 %s 得到 %v，应为 %v", recordSize, tt.ip, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestLookupIPv4Database(t *testing.T) {
+	data, germany, _ := testData()
+	r, err := FromBytes(buildDatabase(t, 24, 4, []testNetwork{{"1.2.3.0/24", germany}}, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.Lookup(net.ParseIP("1.2.3.4")); err != nil || got == nil {
+		t.Errorf("查询 1.2.3.4 得到 %v, %v", got, err)
+	}
+	if _, err := r.Lookup(net.ParseIP("2001:db8::1")); err == nil {
+		t.Error("IPv4数据库中查询IPv6地址应该报错")
+	}
+	if _, err := r.Lookup(net.IP{1, 2, 3}); err == nil {
+		t.Error("无效的IP应该报错")
+	}
+}
+
+// 28位记录的最高4位放在中间字节里，需要大于 2^24 的值才能测到
+func TestReadNode28(t *testing.T) {
+	r := &Reader{
+		Metadata:  Metadata{RecordSize: 28},
+		buf:       []byte{0x12, 0x34, 0x56, 0xAB, 0x78, 0x9A, 0xBC},
+		nodeCount: 1,
+		treeSize:  7,
+	}
+	for bit, want := range []uint{0xA123456, 0xB789ABC} {
+		got, err := r.readNode(0, uint(bit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("第 %d 条记录为 %#x，应为 %#x", bit, got, want)
+		}
+	}
+	if _, err := r.readNode(1, 0); err == nil {
+		t.Error("超出搜索树的节点应该报错")
+	}
+}
+
+func TestPointer(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want uint
+	}{
+		{"1个字节", []byte{0x20 | 0x05, 0x01}, 0x501},
+		{"2个字节", []byte{0x20 | 0x08 | 0x03, 0x01, 0x02}, 0x30102 + 2048},
+		{"3个字节", []byte{0x20 | 0x10 | 0x01, 0x01, 0x02, 0x03}, 0x1010203 + 526336},
+		{"4个字节", []byte{0x20 | 0x18 | 0x07, 0x01, 0x02, 0x03, 0x04}, 0x01020304},
+	}
+	for _, tt := range tests {
+		d := decoder{buf: tt.data}
+		typ, size, offset, err := d.controlByte(0)
+		if err != nil || typ != typePointer {
+			t.Fatalf("%s: 类型 %d, %v", tt.name, typ, err)
+		}
+		got, next, err := d.pointer(size, offset)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want || next != uint(len(tt.data)) {
+			t.Errorf("%s: 指向 %#x，下一个偏移 %d，应为 %#x 和 %d", tt.name, got, next, tt.want, len(tt.data))
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	var full bytes.Buffer
+	encodeValue(&full, []field{{"names", []any{"Berlin", uint64(1 << 40)}}})
+
+	for i := 0; i < full.Len(); i++ {
+		d := decoder{buf: full.Bytes()[:i]}
+		if _, _, err := d.decode(0, 0); !errors.Is(err, errOutOfRange) {
+			t.Errorf("截断到 %d 个字节时错误为 %v", i, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"扩展类型缺少第二个字节", []byte{0x00}},
+		{"长度缺少额外字节", []byte{typeString<<5 | 30, 0x01}},
+		{"指针缺少字节", []byte{0x20 | 0x08, 0x01}},
+		{"指针指向数据段之外", []byte{0x20, 0x40}},
+	}
+	for _, tt := range tests {
+		d := decoder{buf: tt.data}
+		if _, _, err := d.decode(0, 0); !errors.Is(err, errOutOfRange) {
+			t.Errorf("%s: 错误为 %v", tt.name, err)
+		}
+	}
+
+	// 指向自己的指针
+	d := decoder{buf: []byte{0x20, 0x00}}
+	if _, _, err := d.decode(0, 0); err == nil {
+		t.Error("循环的指针应该报错")
+	}
+}
+
+func TestFromBytesTruncated(t *testing.T) {
+	data, germany, _ := testData()
+	db := buildDatabase(t, 24, 6, []testNetwork{{"1.2.3.0/24", germany}}, data)
+	marker := bytes.LastIndex(db, metadataMarker)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"空文件", nil},
+		{"没有元数据", db[:marker]},
+		{"元数据被截断", db[:len(db)-3]},
+		// 去掉开头的搜索树，元数据中的节点数超过文件大小
+		{"搜索树被截断", db[marker-4:]},
+	}
+	for _, tt := range tests {
+		if _, err := FromBytes(tt.data); err == nil {
+			t.Errorf("%s: 应该报错", tt.name)
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package nbt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// 数组和列表的最大长度，防止恶意数据分配过多内存
+const maxArrayLength = 1 << 24
+
+// 长度字段在读到数据之前不可信，最多先分配这么多元素，之后按读到的数据增长
+const initialCapacity = 1024
+
+// Decoder 从输入流读取 NBT 并解码为 Go 值
+type Decoder struct {
+	r io.ByteReader
+}
+
+// NewDecoder 创建从 r 读取的解码器，r 不是 io.ByteReader 时会加上缓冲
+func NewDecoder(r io.Reader) *Decoder {
+	if br, ok := r.(io.ByteReader); ok {
+		return &Decoder{r: br}
+	}
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode 按文件格式解码，返回根标签的名称
+func (d *Decoder) Decode(v any) (string, error) {
+	return d.decode(v, true)
+}
+
+// DecodeNetwork 按网络格式解码，根标签不带名称
+func (d *Decoder) DecodeNetwork(v any) error {
+	_, err := d.decode(v, false)
+	return err
+}
+
+func (d *Decoder) decode(v any, named bool) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return "", errors.New("nbt: decode target must be a non-nil pointer")
+	}
+
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if tag == TagEnd {
+		return "", errors.New("nbt: root tag must not be TAG_End")
+	}
+
+	var name string
+	if named {
+		if name, err = d.readString(); err != nil {
+			return "", err
+		}
+	}
+	return name, d.readPayload(tag, rv.Elem(), 0)
+}
+
+// Unmarshal 按文件格式解码，返回根标签的名称
+func Unmarshal(data []byte, v any) (string, error) {
+	return NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// UnmarshalNetwork 按网络格式解码
+func UnmarshalNetwork(data []byte, v any) error {
+	return NewDecoder(bytes.NewReader(data)).DecodeNetwork(v)
+}
+
+func (d *Decoder) read(n int) ([]byte, error) {
+	buf := make([]byte, 0, min(n, initialCapacity))
+	for len(buf) < n {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		buf = append(buf, b)
+	}
+	return buf, nil
+}
+
+func (d *Decoder) readInt16() (int16, error) {
+	b, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+func (d *Decoder) readInt32() (int32, error) {
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (d *Decoder) readInt64() (int64, error) {
+	b, err := d.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (d *Decoder) readLength() (int, error) {
+	n, err := d.readInt32()
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > maxArrayLength {
+		return 0, fmt.Errorf("nbt: invalid length: %d", n)
+	}
+	return int(n), nil
+}
+
+// 列表的长度，元素类型为 TAG_End 的列表只能是空列表
+func (d *Decoder) readListLength(elemType byte) (int, error) {
+	n, err := d.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if elemType == TagEnd && n > 0 {
+		return 0, fmt.Errorf("nbt: TAG_End list must be empty: %d", n)
+	}
+	return n, nil
+}
+
+func (d *Decoder) readString() (string, error) {
+	n, err := d.readInt16()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.read(int(uint16(n)))
+	if err != nil {
+		return "", err
+	}
+	return decodeMUTF8(b)
+}
+
+// 读取一个标签的内容，得到通用的 Go 值
+func (d *Decoder) readGeneric(tag byte, depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, errors.New("nbt: nesting too deep")
+	}
+
+	switch tag {
+	case TagByte:
+		b, err := d.r.ReadByte()
+		return int8(b), err
+	case TagShort:
+		return d.readInt16()
+	case TagInt:
+		return d.readInt32()
+	case TagLong:
+		return d.readInt64()
+	case TagFloat:
+		v, err := d.readInt32()
+		return math.Float32frombits(uint32(v)), err
+	case TagDouble:
+		v, err := d.readInt64()
+		return math.Float64frombits(uint64(v)), err
+	case TagString:
+		return d.readString()
+	case TagByteArray:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		return d.read(n)
+	case TagIntArray:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]int32, 0, min(n, initialCapacity))
+		for len(values) < n {
+			v, err := d.readInt32()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case TagLongArray:
+		n, err := d.readLength()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]int64, 0, min(n, initialCapacity))
+		for len(values) < n {
+			v, err := d.readInt64()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case TagList:
+		elemType, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n, err := d.readListLength(elemType)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, 0, min(n, initialCapacity))
+		for len(values) < n {
+			v, err := d.readGeneric(elemType, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case TagCompound:
+		values := make(map[string]any)
+		for {
+			elemType, err := d.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if elemType == TagEnd {
+				return values, nil
+			}
+			name, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			if values[name], err = d.readGeneric(elemType, depth+1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("nbt: unknown tag type %d", tag)
+}
+
+// 把标签内容解码到 rv
+func (d *Decoder) readPayload(tag byte, rv reflect.Value, depth int) error {
+	if depth > maxDepth {
+		return errors.New("nbt: nesting too deep")
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return d.readPayload(tag, rv.Elem(), depth)
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return &TypeMismatchError{Tag: tag, Type: rv.Type().String()}
+		}
+		v, err := d.readGeneric(tag, depth)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+
+	switch tag {
+	case TagByte, TagShort, TagInt, TagLong, TagFloat, TagDouble, TagString:
+		v, err := d.readGeneric(tag, depth)
+		if err != nil {
+			return err
+		}
+		return setScalar(tag, rv, v)
+	case TagByteArray, TagIntArray, TagLongArray:
+		v, err := d.readGeneric(tag, depth)
+		if err != nil {
+			return err
+		}
+		return setArray(tag, rv, reflect.ValueOf(v))
+	case TagList:
+		return d.readList(rv, depth)
+	case TagCompound:
+		switch rv.Kind() {
+		case reflect.Struct:
+			return d.readStruct(rv, depth)
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				break
+			}
+			return d.readMap(rv, depth)
+		}
+		return &TypeMismatchError{Tag: tag, Type: rv.Type().String()}
+	}
+	return fmt.Errorf("nbt: unknown tag type %d", tag)
+}
+
+func setScalar(tag byte, rv reflect.Value, v any) error {
+	value := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		if tag == TagByte {
+			rv.SetBool(v.(int8) != 0)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value.CanInt() {
+			rv.SetInt(value.Int())
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value.CanInt() {
+			rv.SetUint(uint64(value.Int()))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if value.CanFloat() {
+			rv.SetFloat(value.Float())
+			return nil
+		}
+		if value.CanInt() {
+			rv.SetFloat(float64(value.Int()))
+			return nil
+		}
+	case reflect.String:
+		if tag == TagString {
+			rv.SetString(v.(string))
+			return nil
+		}
+	}
+	return &TypeMismatchError{Tag: tag, Type: rv.Type().String()}
+}
+
+func setArray(tag byte, rv reflect.Value, value reflect.Value) error {
+	if rv.Kind() != reflect.Slice {
+		return &TypeMismatchError{Tag: tag, Type: rv.Type().String()}
+	}
+	if value.Type().AssignableTo(rv.Type()) {
+		rv.Set(value)
+		return nil
+	}
+
+	// 元素类型不同时逐个转换，例如 TAG_Byte_Array 解码到 []int8
+	out := reflect.MakeSlice(rv.Type(), value.Len(), value.Len())
+	for i := 0; i < value.Len(); i++ {
+		elem := value.Index(i)
+		var generic any
+		switch tag {
+		case TagByteArray:
+			generic = int8(elem.Uint())
+		default:
+			generic = elem.Interface()
+		}
+		if err := setScalar(elemTagOf(tag), out.Index(i), generic); err != nil {
+			return err
+		}
+	}
+	rv.Set(out)
+	return nil
+}
+
+func elemTagOf(arrayTag byte) byte {
+	switch arrayTag {
+	case TagByteArray:
+		return TagByte
+	case TagIntArray:
+		return TagInt
+	}
+	return TagLong
+}
+
+func (d *Decoder) readList(rv reflect.Value, depth int) error {
+	elemType, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	n, err := d.readListLength(elemType)
+	if err != nil {
+		return err
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice:
+		out := reflect.MakeSlice(rv.Type(), 0, min(n, initialCapacity))
+		for out.Len() < n {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			if err := d.readPayload(elemType, elem, depth+1); err != nil {
+				return err
+			}
+			out = reflect.Append(out, elem)
+		}
+		rv.Set(out)
+		return nil
+	case reflect.Array:
+		if n != rv.Len() {
+			return fmt.Errorf("nbt: list length %d does not match array length %d", n, rv.Len())
+		}
+		for i := 0; i < n; i++ {
+			if err := d.readPayload(elemType, rv.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return &TypeMismatchError{Tag: TagList, Type: rv.Type().String()}
+}
+
+func (d *Decoder) readMap(rv reflect.Value, depth int) error {
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMap(rv.Type()))
+	}
+	for {
+		tag, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if tag == TagEnd {
+			return nil
+		}
+		name, err := d.readString()
+		if err != nil {
+			return err
+		}
+		value := reflect.New(rv.Type().Elem()).Elem()
+		if err := d.readPayload(tag, value, depth+1); err != nil {
+			return err
+		}
+		rv.SetMapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()), value)
+	}
+}
+
+func (d *Decoder) readStruct(rv reflect.Value, depth int) error {
+	fields := make(map[string][]int)
+	for _, field := range structFields(rv.Type()) {
+		fields[field.name] = field.index
+	}
+
+	for {
+		tag, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if tag == TagEnd {
+			return nil
+		}
+		name, err := d.readString()
+		if err != nil {
+			return err
+		}
+
+		index, ok := fields[name]
+		if !ok {
+			// 没有对应字段的标签直接跳过
+			if _, err := d.readGeneric(tag, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.readPayload(tag, rv.FieldByIndex(index), depth+1); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Encoder 把 Go 值编码为 NBT 写入输出流
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder 创建写入 w 的编码器
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode 按文件格式编码，根标签带名称
+func (e *Encoder) Encode(name string, v any) error {
+	return e.encode(v, &name)
+}
+
+// EncodeNetwork 按网络格式编码，根标签不带名称
+func (e *Encoder) EncodeNetwork(v any) error {
+	return e.encode(v, nil)
+}
+
+func (e *Encoder) encode(v any, name *string) error {
+	rv := reflect.ValueOf(v)
+	tag, rv, err := tagOf(rv)
+	if err != nil {
+		return err
+	}
+
+	s := &encodeState{}
+	s.WriteByte(tag)
+	if name != nil {
+		if err := s.writeString(*name); err != nil {
+			return err
+		}
+	}
+	if err := s.writePayload(tag, rv, 0); err != nil {
+		return err
+	}
+	_, err = e.w.Write(s.Bytes())
+	return err
+}
+
+// Marshal 按文件格式编码，根标签带名称
+func Marshal(name string, v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(name, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalNetwork 按网络格式编码，根标签不带名称
+func MarshalNetwork(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).EncodeNetwork(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type encodeState struct {
+	bytes.Buffer
+}
+
+var listType = reflect.TypeOf(List{})
+
+// Marshaler 由类型自己决定编码成什么值，返回值再按普通的规则编码
+type Marshaler interface {
+	MarshalNBT() (any, error)
+}
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// 去掉指针和接口并调用 Marshaler，返回值对应的标签类型
+func tagOf(rv reflect.Value) (byte, reflect.Value, error) {
+	for depth := 0; ; depth++ {
+		if depth > maxDepth {
+			return 0, rv, errors.New("nbt: nesting too deep")
+		}
+		if !rv.IsValid() || isNil(rv) && (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) {
+			return 0, rv, errors.New("nbt: cannot encode nil")
+		}
+		if rv.Type().Implements(marshalerType) && rv.CanInterface() {
+			v, err := rv.Interface().(Marshaler).MarshalNBT()
+			if err != nil {
+				return 0, rv, err
+			}
+			rv = reflect.ValueOf(v)
+			continue
+		}
+		if rv.Kind() != reflect.Pointer && rv.Kind() != reflect.Interface {
+			break
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Type() == listType {
+		return TagList, rv, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return TagByte, rv, nil
+	case reflect.Int16, reflect.Uint16:
+		return TagShort, rv, nil
+	case reflect.Int32, reflect.Uint32, reflect.Int, reflect.Uint:
+		return TagInt, rv, nil
+	case reflect.Int64, reflect.Uint64:
+		return TagLong, rv, nil
+	case reflect.Float32:
+		return TagFloat, rv, nil
+	case reflect.Float64:
+		return TagDouble, rv, nil
+	case reflect.String:
+		return TagString, rv, nil
+	case reflect.Slice, reflect.Array:
+		switch rv.Type().Elem().Kind() {
+		case reflect.Uint8, reflect.Int8:
+			return TagByteArray, rv, nil
+		case reflect.Int32:
+			return TagIntArray, rv, nil
+		case reflect.Int64:
+			return TagLongArray, rv, nil
+		}
+		return TagList, rv, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return 0, rv, &UnsupportedTypeError{Type: rv.Type().String()}
+		}
+		return TagCompound, rv, nil
+	case reflect.Struct:
+		return TagCompound, rv, nil
+	}
+	return 0, rv, &UnsupportedTypeError{Type: rv.Type().String()}
+}
+
+func (s *encodeState) writeString(str string) error {
+	data := encodeMUTF8(str)
+	if len(data) > math.MaxUint16 {
+		return errors.New("nbt: string too long")
+	}
+	binary.Write(s, binary.BigEndian, uint16(len(data)))
+	s.Write(data)
+	return nil
+}
+
+func (s *encodeState) writePayload(tag byte, rv reflect.Value, depth int) error {
+	if depth > maxDepth {
+		return errors.New("nbt: nesting too deep")
+	}
+
+	switch tag {
+	case TagByte:
+		if rv.Kind() == reflect.Bool {
+			if rv.Bool() {
+				s.WriteByte(1)
+			} else {
+				s.WriteByte(0)
+			}
+			return nil
+		}
+		s.WriteByte(byte(intValue(rv)))
+	case TagShort:
+		binary.Write(s, binary.BigEndian, int16(intValue(rv)))
+	case TagInt:
+		binary.Write(s, binary.BigEndian, int32(intValue(rv)))
+	case TagLong:
+		binary.Write(s, binary.BigEndian, intValue(rv))
+	case TagFloat:
+		binary.Write(s, binary.BigEndian, float32(rv.Float()))
+	case TagDouble:
+		binary.Write(s, binary.BigEndian, rv.Float())
+	case TagString:
+		return s.writeString(rv.String())
+	case TagByteArray:
+		binary.Write(s, binary.BigEndian, int32(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			s.WriteByte(byte(intValue(rv.Index(i))))
+		}
+	case TagIntArray:
+		binary.Write(s, binary.BigEndian, int32(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			binary.Write(s, binary.BigEndian, int32(rv.Index(i).Int()))
+		}
+	case TagLongArray:
+		binary.Write(s, binary.BigEndian, int32(rv.Len()))
+		for i := 0; i < rv.Len(); i++ {
+			binary.Write(s, binary.BigEndian, rv.Index(i).Int())
+		}
+	case TagList:
+		return s.writeList(rv, depth)
+	case TagCompound:
+		if rv.Kind() == reflect.Map {
+			return s.writeMap(rv, depth)
+		}
+		return s.writeStruct(rv, depth)
+	default:
+		return &UnsupportedTypeError{Type: rv.Type().String()}
+	}
+	return nil
+}
+
+func intValue(rv reflect.Value) int64 {
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	}
+	return rv.Int()
+}
+
+func (s *encodeState) writeList(rv reflect.Value, depth int) error {
+	elemType := TagEnd
+	if rv.Type() == listType {
+		list := rv.Interface().(List)
+		elemType = list.ElemType
+		rv = reflect.ValueOf(list.Elems)
+	}
+
+	elems := make([]reflect.Value, rv.Len())
+	for i := range elems {
+		tag, elem, err := tagOf(rv.Index(i))
+		if err != nil {
+			return err
+		}
+		if elemType == TagEnd {
+			elemType = tag
+		} else if tag != elemType {
+			return errors.New("nbt: mixed list element types: " + TagName(elemType) + " and " + TagName(tag))
+		}
+		elems[i] = elem
+	}
+
+	s.WriteByte(elemType)
+	binary.Write(s, binary.BigEndian, int32(len(elems)))
+	for _, elem := range elems {
+		if err := s.writePayload(elemType, elem, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *encodeState) writeNamed(name string, rv reflect.Value, depth int) error {
+	tag, rv, err := tagOf(rv)
+	if err != nil {
+		return err
+	}
+	s.WriteByte(tag)
+	if err := s.writeString(name); err != nil {
+		return err
+	}
+	return s.writePayload(tag, rv, depth+1)
+}
+
+func (s *encodeState) writeMap(rv reflect.Value, depth int) error {
+	iter := rv.MapRange()
+	for iter.Next() {
+		value := iter.Value()
+		if isNil(value) {
+			continue
+		}
+		if err := s.writeNamed(iter.Key().String(), value, depth); err != nil {
+			return err
+		}
+	}
+	s.WriteByte(TagEnd)
+	return nil
+}
+
+func (s *encodeState) writeStruct(rv reflect.Value, depth int) error {
+	for _, field := range structFields(rv.Type()) {
+		value := rv.FieldByIndex(field.index)
+		if isNil(value) {
+			continue
+		}
+		if field.omitEmpty && value.IsZero() {
+			continue
+		}
+		if err := s.writeNamed(field.name, value, depth); err != nil {
+			return err
+		}
+	}
+	s.WriteByte(TagEnd)
+	return nil
+}
+
+func isNil(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		return rv.IsNil()
+	}
+	return false
+}
+
+type fieldInfo struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// 结构体中需要编码的字段，匿名结构体字段会被展开
+func structFields(t reflect.Type) []fieldInfo {
+	var fields []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("nbt")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, inner := range structFields(f.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, fieldInfo{
+			name:      name,
+			index:     []int{i},
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	return fields
+}
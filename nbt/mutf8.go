@@ -0,0 +1,65 @@
+package nbt
+
+import (
+	"errors"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// NBT 字符串使用 Java 的 Modified UTF-8：
+// U+0000 编码为两个字节，BMP 以外的字符拆成两个代理项各编码为三个字节
+
+func encodeMUTF8(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r != 0 && r < 0x80:
+			out = append(out, byte(r))
+		case r < 0x800:
+			out = append(out, 0xC0|byte(r>>6), 0x80|byte(r&0x3F))
+		case r < 0x10000:
+			out = append(out, 0xE0|byte(r>>12), 0x80|byte((r>>6)&0x3F), 0x80|byte(r&0x3F))
+		default:
+			r1, r2 := utf16.EncodeRune(r)
+			for _, c := range []rune{r1, r2} {
+				out = append(out, 0xE0|byte(c>>12), 0x80|byte((c>>6)&0x3F), 0x80|byte(c&0x3F))
+			}
+		}
+	}
+	return out
+}
+
+var errInvalidMUTF8 = errors.New("nbt: invalid string encoding")
+
+func decodeMUTF8(b []byte) (string, error) {
+	units := make([]uint16, 0, len(b))
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c < 0x80:
+			units = append(units, uint16(c))
+			i++
+		case c&0xE0 == 0xC0:
+			if i+1 >= len(b) || b[i+1]&0xC0 != 0x80 {
+				return "", errInvalidMUTF8
+			}
+			units = append(units, uint16(c&0x1F)<<6|uint16(b[i+1]&0x3F))
+			i += 2
+		case c&0xF0 == 0xE0:
+			if i+2 >= len(b) || b[i+1]&0xC0 != 0x80 || b[i+2]&0xC0 != 0x80 {
+				return "", errInvalidMUTF8
+			}
+			units = append(units, uint16(c&0x0F)<<12|uint16(b[i+1]&0x3F)<<6|uint16(b[i+2]&0x3F))
+			i += 3
+		default:
+			return "", errInvalidMUTF8
+		}
+	}
+
+	runes := utf16.Decode(units)
+	out := make([]byte, 0, len(runes))
+	for _, r := range runes {
+		out = utf8.AppendRune(out, r)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,96 @@
+// Package nbt 实现 Minecraft 的 NBT 二进制格式。
+//
+// 支持两种根标签格式：
+//   - 文件格式：根标签带名称，用于存档和结构文件（gzip 压缩由调用方处理）
+//   - 网络格式：1.20.2 起数据包中的根标签不带名称，1.20.3 起根标签可以是任意类型
+//
+// Go 类型和标签的对应关系：
+//
+//	bool、int8、uint8        TAG_Byte
+//	int16、uint16            TAG_Short
+//	int32、uint32、int、uint  TAG_Int
+//	int64、uint64            TAG_Long
+//	float32                  TAG_Float
+//	float64                  TAG_Double
+//	string                   TAG_String
+//	[]byte、[]int8           TAG_Byte_Array
+//	[]int32                  TAG_Int_Array
+//	[]int64                  TAG_Long_Array
+//	其他切片和数组           TAG_List
+//	结构体、map[string]T     TAG_Compound
+//
+// 结构体字段使用 `nbt:"name,omitempty"` 标签指定名称，`nbt:"-"` 表示忽略。
+// 实现 Marshaler 的类型按 MarshalNBT 返回的值编码。
+// 解码到 interface{} 时，复合标签得到 map[string]any，列表得到 []any。
+package nbt
+
+import "fmt"
+
+// 标签类型
+const (
+	TagEnd byte = iota
+	TagByte
+	TagShort
+	TagInt
+	TagLong
+	TagFloat
+	TagDouble
+	TagByteArray
+	TagString
+	TagList
+	TagCompound
+	TagIntArray
+	TagLongArray
+)
+
+// 嵌套深度上限，和原版一致
+const maxDepth = 512
+
+var tagNames = [...]string{
+	TagEnd:       "TAG_End",
+	TagByte:      "TAG_Byte",
+	TagShort:     "TAG_Short",
+	TagInt:       "TAG_Int",
+	TagLong:      "TAG_Long",
+	TagFloat:     "TAG_Float",
+	TagDouble:    "TAG_Double",
+	TagByteArray: "TAG_Byte_Array",
+	TagString:    "TAG_String",
+	TagList:      "TAG_List",
+	TagCompound:  "TAG_Compound",
+	TagIntArray:  "TAG_Int_Array",
+	TagLongArray: "TAG_Long_Array",
+}
+
+// TagName 返回标签类型的名称
+func TagName(id byte) string {
+	if int(id) < len(tagNames) {
+		return tagNames[id]
+	}
+	return fmt.Sprintf("TAG_Unknown(%d)", id)
+}
+
+// List 用于编码时明确指定列表的元素类型，例如空列表
+type List struct {
+	ElemType byte
+	Elems    []any
+}
+
+// UnsupportedTypeError 表示无法编码的 Go 类型
+type UnsupportedTypeError struct {
+	Type string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "nbt: unsupported type " + e.Type
+}
+
+// TypeMismatchError 表示标签类型和目标 Go 类型不匹配
+type TypeMismatchError struct {
+	Tag  byte
+	Type string
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("nbt: cannot decode %s into %s", TagName(e.Tag), e.Type)
+}
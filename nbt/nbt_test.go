@@ -0,0 +1,295 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type nested struct {
+	Name  string `nbt:"name"`
+	Empty string `nbt:"empty,omitempty"`
+}
+
+// 每种标签类型各一个字段
+type allTags struct {
+	Bool      bool             `nbt:"bool"`
+	Byte      int8             `nbt:"byte"`
+	Short     int16            `nbt:"short"`
+	Int       int32            `nbt:"int"`
+	Long      int64            `nbt:"long"`
+	Float     float32          `nbt:"float"`
+	Double    float64          `nbt:"double"`
+	String    string           `nbt:"string"`
+	ByteArray []byte           `nbt:"byte_array"`
+	IntArray  []int32          `nbt:"int_array"`
+	LongArray []int64          `nbt:"long_array"`
+	List      []string         `nbt:"list"`
+	Lists     [][]int16        `nbt:"lists"`
+	Compound  nested           `nbt:"compound"`
+	Compounds []nested         `nbt:"compounds"`
+	Map       map[string]int32 `nbt:"map"`
+}
+
+func sampleTags() allTags {
+	return allTags{
+		Bool:      true,
+		Byte:      -128,
+		Short:     math.MaxInt16,
+		Int:       math.MinInt32,
+		Long:      math.MaxInt64,
+		Float:     1.5,
+		Double:    -0.25,
+		String:    "Hypixel \x00 封禁 🚫",
+		ByteArray: []byte{0, 1, 0xff},
+		IntArray:  []int32{-1, 0, 1 << 30},
+		LongArray: []int64{math.MinInt64, 42},
+		List:      []string{"a", "b"},
+		Lists:     [][]int16{{1, 2}, {}},
+		Compound:  nested{Name: "inner"},
+		Compounds: []nested{{Name: "x"}, {Name: "y"}},
+		Map:       map[string]int32{"one": 1},
+	}
+}
+
+func TestRoundTripFile(t *testing.T) {
+	want := sampleTags()
+	data, err := Marshal("root", want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got allTags
+	name, err := Unmarshal(data, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "root" {
+		t.Errorf("根标签名称为 %q", name)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("解码结果 %+v，应为 %+v", got, want)
+	}
+}
+
+func TestRoundTripNetwork(t *testing.T) {
+	want := sampleTags()
+	data, err := MarshalNetwork(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, _ := Marshal("", want)
+	// 网络格式只是少了根标签的名称
+	if !bytes.Equal(data, append([]byte{TagCompound}, file[3:]...)) {
+		t.Error("网络格式和去掉名称的文件格式不同")
+	}
+
+	var got allTags
+	if err := UnmarshalNetwork(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("解码结果 %+v，应为 %+v", got, want)
+	}
+}
+
+// 1.20.3 起网络格式的根标签可以是任意类型，解码到 any 得到通用的值
+func TestRoundTripGeneric(t *testing.T) {
+	values := []any{
+		int8(-5),
+		int16(300),
+		int32(70000),
+		int64(1 << 40),
+		float32(0.5),
+		float64(3.25),
+		"text",
+		[]byte{1, 2, 3},
+		[]int32{4, 5},
+		[]int64{6},
+		[]any{"a", "b"},
+		map[string]any{"nested": map[string]any{"list": []any{int32(1)}}},
+	}
+	for _, want := range values {
+		for _, network := range []bool{false, true} {
+			var data []byte
+			var err error
+			if network {
+				data, err = MarshalNetwork(want)
+			} else {
+				data, err = Marshal("v", want)
+			}
+			if err != nil {
+				t.Fatalf("%T: %v", want, err)
+			}
+
+			var got any
+			if network {
+				err = UnmarshalNetwork(data, &got)
+			} else {
+				_, err = Unmarshal(data, &got)
+			}
+			if err != nil {
+				t.Fatalf("%T: %v", want, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%T 解码为 %#v，应为 %#v", want, got, want)
+			}
+		}
+	}
+}
+
+// 原版 hello_world.nbt
+const helloWorld = "0a 000b 68656c6c6f20776f726c64 08 0004 6e616d65 0009 42616e616e72616d61 00"
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestHelloWorld(t *testing.T) {
+	want := mustHex(t, helloWorld)
+
+	var v nested
+	name, err := Unmarshal(want, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "hello world" || v.Name != "Bananrama" {
+		t.Errorf("解码为 %q %+v", name, v)
+	}
+
+	data, err := Marshal(name, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("编码为 % x，应为 % x", data, want)
+	}
+}
+
+func TestEmptyList(t *testing.T) {
+	data, err := MarshalNetwork(List{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空列表的元素类型是 TAG_End
+	if want := mustHex(t, "09 00 00000000"); !bytes.Equal(data, want) {
+		t.Errorf("空列表编码为 % x", data)
+	}
+
+	var got []string
+	if err := UnmarshalNetwork(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("空列表解码为 %v", got)
+	}
+}
+
+// 嵌套 depth 层列表，最里面是一个空列表
+func nestedLists(depth int) []byte {
+	data := []byte{TagList}
+	for i := 0; i < depth; i++ {
+		data = append(data, TagList, 0, 0, 0, 1)
+	}
+	return append(data, TagEnd, 0, 0, 0, 0)
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"负数的字节数组长度", "07 ffffffff"},
+		{"负数的整数数组长度", "0b 80000000"},
+		{"负数的列表长度", "09 01 ffffffff"},
+		{"超过上限的长整数数组", "0c 01000001"},
+		{"超过上限的列表", "09 01 01000001"},
+		// 长度在上限以内但没有数据，不能先按长度分配
+		{"长度大于数据", "0c 01000000 0000000000000001"},
+		{"未知的标签类型", "0d"},
+		{"复合标签中未知的标签类型", "0a 0d 0001 61"},
+		{"列表中未知的标签类型", "09 0d 00000001"},
+		{"TAG_End 列表不为空", "09 00 00000001"},
+		{"根标签为 TAG_End", "00"},
+		{"复合标签没有结束", "0a 01 0001 61 05"},
+		{"字符串编码无效", "08 0001 ff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := mustHex(t, tt.data)
+			var generic any
+			if err := UnmarshalNetwork(data, &generic); err == nil {
+				t.Errorf("解码到 any 应该返回错误，得到 %#v", generic)
+			}
+		})
+	}
+
+	// 解码到具体类型的路径
+	var ints []int32
+	if err := UnmarshalNetwork(mustHex(t, "09 00 00000003"), &ints); err == nil {
+		t.Error("TAG_End 列表不为空时解码到切片应该返回错误")
+	}
+	var lists [][]int32
+	if err := UnmarshalNetwork(mustHex(t, "09 09 ffffffff"), &lists); err == nil {
+		t.Error("负数的列表长度解码到切片应该返回错误")
+	}
+}
+
+func TestDecodeDepth(t *testing.T) {
+	var generic any
+	if err := UnmarshalNetwork(nestedLists(maxDepth-1), &generic); err != nil {
+		t.Errorf("嵌套 %d 层应该可以解码: %v", maxDepth-1, err)
+	}
+	if err := UnmarshalNetwork(nestedLists(maxDepth+1), &generic); err == nil {
+		t.Errorf("嵌套 %d 层应该返回错误", maxDepth+1)
+	}
+
+	var typed [][][]any
+	if err := UnmarshalNetwork(nestedLists(maxDepth+1), &typed); err == nil {
+		t.Errorf("嵌套 %d 层解码到切片应该返回错误", maxDepth+1)
+	}
+
+	// 复合标签嵌套
+	data := []byte{TagCompound}
+	for i := 0; i <= maxDepth; i++ {
+		data = append(data, TagCompound, 0, 1, 'a')
+	}
+	for i := 0; i <= maxDepth+1; i++ {
+		data = append(data, TagEnd)
+	}
+	if err := UnmarshalNetwork(data, &generic); err == nil {
+		t.Errorf("复合标签嵌套超过 %d 层应该返回错误", maxDepth)
+	}
+}
+
+func TestEncodeDepth(t *testing.T) {
+	var v any = "leaf"
+	for i := 0; i <= maxDepth+1; i++ {
+		v = []any{v}
+	}
+	if _, err := MarshalNetwork(v); err == nil {
+		t.Errorf("嵌套超过 %d 层应该返回错误", maxDepth)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := map[string]any{
+		"列表元素类型不一致": []any{int32(1), "a"},
+		"不支持的类型":    map[int]string{1: "a"},
+		"空值":        nil,
+		"字符串太长":     strings.Repeat("a", math.MaxUint16+1),
+	}
+	for name, v := range tests {
+		if _, err := MarshalNetwork(v); err == nil {
+			t.Errorf("%s 应该返回错误", name)
+		}
+	}
+}